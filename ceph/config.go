@@ -1,13 +1,36 @@
 package ceph
 
 import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
 	"terraform-provider-ceph/ceph/sdk"
 )
 
 // Config struct for the ceph-provider
 type Config struct {
-	Clusters []string
+	// Clusters connection settings by cluster, settings missing in a
+	// cluster block are inherited from the provider block
+	Clusters []*sdk.ConnConfig
 }
 
 // ClusterClient for client of cluster
-type ClusterClient map[string]*sdk.CephClient
+type ClusterClient map[string]sdk.CephClientI
+
+// connKey identifies the connections which can be shared by providers, only
+// the sha256 of the key of the user is part of it to keep the key out of logs
+func connKey(config *sdk.ConnConfig) string {
+	overrides := make([]string, 0, len(config.ConfigOverrides))
+	for k, v := range config.ConfigOverrides {
+		overrides = append(overrides, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(overrides)
+	var key string
+	if config.Key != "" {
+		key = fmt.Sprintf("%x", sha256.Sum256([]byte(config.Key)))
+	}
+	return fmt.Sprintf("%s (mon_host=%s user=%s key_sha256=%s keyring=%s config_path=%s %s)", config.Cluster,
+		config.MonHost, config.User, key, config.Keyring, config.ConfigPath, strings.Join(overrides, " "))
+}
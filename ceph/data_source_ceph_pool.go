@@ -0,0 +1,41 @@
+package ceph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	log "github.com/sirupsen/logrus"
+)
+
+func dataSourceCephPool() *schema.Resource {
+	s := dataSourceSchemaFromResource(resourceCephPool().Schema, "deletion_protection", "rbd_init")
+	s["cluster"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+		Default:  "ceph",
+	}
+	s["name"] = &schema.Schema{
+		Type:         schema.TypeString,
+		Required:     true,
+		ValidateFunc: validation.NoZeroValues,
+	}
+	return &schema.Resource{
+		ReadContext: dataSourceCephPoolRead,
+		Schema:      s,
+	}
+}
+
+func dataSourceCephPoolRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("read data source ceph_pool")
+	id := fmt.Sprintf("%s/%s", d.Get("cluster").(string), d.Get("name").(string))
+	d.SetId(id)
+	if diags = resourceCephPoolRead(ctx, d, meta); diags.HasError() {
+		return diags
+	} else if d.Id() == "" {
+		return diag.Errorf("storage pool '%s' not found", id)
+	}
+	return diags
+}
@@ -0,0 +1,26 @@
+package ceph
+
+import (
+	"testing"
+)
+
+func TestDataSourceCephPool(t *testing.T) {
+	meta := testMeta("ceph")
+	_ = testFakeClient(t, meta, "ceph").CreatePool("pool1", nil)
+	r := dataSourceCephPool()
+
+	state, err := testReadData(r, map[string]interface{}{"name": "pool1"}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.ID != "ceph/pool1" {
+		t.Fatalf("expect id ceph/pool1, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "size", "3")
+	testCheckAttr(t, state, "pool_type", "replicated")
+	testCheckAttr(t, state, "state", "HEALTH_OK")
+
+	if _, err = testReadData(r, map[string]interface{}{"name": "pool2"}, meta); err == nil {
+		t.Fatal("expect error reading a missing pool")
+	}
+}
@@ -0,0 +1,42 @@
+package ceph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	log "github.com/sirupsen/logrus"
+)
+
+func dataSourceCephSnapshot() *schema.Resource {
+	s := dataSourceSchemaFromResource(resourceCephSnapshot().Schema, "force_flatten_children")
+	s["base_volume"] = &schema.Schema{
+		Type:         schema.TypeString,
+		Required:     true,
+		Description:  "$cluster_name/$pool_name/[$namespace/]$volume_name",
+		ValidateFunc: validation.NoZeroValues,
+	}
+	s["name"] = &schema.Schema{
+		Type:         schema.TypeString,
+		Required:     true,
+		ValidateFunc: validation.NoZeroValues,
+	}
+	return &schema.Resource{
+		ReadContext: dataSourceCephSnapshotRead,
+		Schema:      s,
+	}
+}
+
+func dataSourceCephSnapshotRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("read data source ceph_snapshot")
+	id := fmt.Sprintf("%s@%s", d.Get("base_volume").(string), d.Get("name").(string))
+	d.SetId(id)
+	if diags = resourceCephSnapshotRead(ctx, d, meta); diags.HasError() {
+		return diags
+	} else if d.Id() == "" {
+		return diag.Errorf("snapshot '%s' not found", id)
+	}
+	return diags
+}
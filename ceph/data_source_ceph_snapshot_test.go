@@ -0,0 +1,32 @@
+package ceph
+
+import (
+	"testing"
+)
+
+func TestDataSourceCephSnapshot(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	vol, _ := client.CreateVol("pool1", "", "golden", 1024, nil)
+	snap, _ := vol.CreateSnapshot("v1")
+	_ = snap.Protect()
+	vol.Close()
+
+	state, err := testReadData(dataSourceCephSnapshot(), map[string]interface{}{
+		"base_volume": "ceph/pool1/golden",
+		"name":        "v1",
+	}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "id", "ceph/pool1/golden@v1")
+	testCheckAttr(t, state, "protect", "true")
+
+	if _, err = testReadData(dataSourceCephSnapshot(), map[string]interface{}{
+		"base_volume": "ceph/pool1/golden",
+		"name":        "missing",
+	}, meta); err == nil {
+		t.Fatal("expect error reading a missing snapshot")
+	}
+}
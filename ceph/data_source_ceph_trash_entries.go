@@ -0,0 +1,104 @@
+package ceph
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	log "github.com/sirupsen/logrus"
+)
+
+func dataSourceCephTrashEntries() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceCephTrashEntriesRead,
+		Schema: map[string]*schema.Schema{
+			"pool_id": {
+				Type:         schema.TypeString,
+				Required:     true,
+				Description:  "$cluster_name/$pool_name",
+				ValidateFunc: validation.NoZeroValues,
+			},
+			"namespace": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "rbd namespace of the pool, default is the pool itself",
+			},
+			"name": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "only the entries of volumes with this name",
+			},
+			"entries": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "images in the trash, oldest first",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"deletion_time": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"deferred_until": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "the image can't be purged before this time",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceCephTrashEntriesRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("read data source ceph_trash_entries")
+	poolID := d.Get("pool_id").(string)
+	cluster, poolName, err := sdk.ParseCephPool(poolID)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	namespace := d.Get("namespace").(string)
+	id := poolID
+	if namespace != "" {
+		id = fmt.Sprintf("%s/%s", poolID, namespace)
+	}
+	all, err := client.ListTrash(poolName, namespace)
+	if err != nil {
+		return diag.Errorf("list trash of '%s' failed: %v", id, err)
+	}
+	name := d.Get("name").(string)
+	entries := make([]map[string]interface{}, 0, len(all))
+	for _, entry := range all {
+		if name != "" && entry.Name != name {
+			continue
+		}
+		entries = append(entries, map[string]interface{}{
+			"id":             entry.ID,
+			"name":           entry.Name,
+			"deletion_time":  entry.DeletionTime.UTC().Format(time.RFC3339),
+			"deferred_until": entry.DeferredUntil.UTC().Format(time.RFC3339),
+		})
+	}
+
+	d.SetId(id)
+	_ = d.Set("entries", entries)
+	return nil
+}
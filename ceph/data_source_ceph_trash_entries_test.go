@@ -0,0 +1,45 @@
+package ceph
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDataSourceCephTrashEntries(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_ = client.CreateRBDNamespace("pool1", "tenant1")
+	for _, name := range []string{"vm1", "vm2"} {
+		_, _ = client.CreateVol("pool1", "", name, 1024, nil)
+		_ = client.TrashVol("pool1", "", name, time.Hour)
+	}
+	_, _ = client.CreateVol("pool1", "tenant1", "vm1", 1024, nil)
+	_ = client.TrashVol("pool1", "tenant1", "vm1", 0)
+	r := dataSourceCephTrashEntries()
+
+	state, err := testReadData(r, map[string]interface{}{"pool_id": "ceph/pool1"}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "entries.#", "2")
+
+	state, err = testReadData(r, map[string]interface{}{
+		"pool_id":   "ceph/pool1",
+		"namespace": "tenant1",
+		"name":      "vm1",
+	}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "id", "ceph/pool1/tenant1")
+	testCheckAttr(t, state, "entries.#", "1")
+	testCheckAttr(t, state, "entries.0.name", "vm1")
+	entries, _ := client.ListTrash("pool1", "tenant1")
+	testCheckAttr(t, state, "entries.0.id", entries[0].ID)
+	testCheckAttr(t, state, "entries.0.deferred_until", state.Attributes["entries.0.deletion_time"])
+
+	if _, err = testReadData(r, map[string]interface{}{"pool_id": "ceph/pool1", "namespace": "tenant2"}, meta); err == nil {
+		t.Fatal("expect error listing the trash of a missing namespace")
+	}
+}
@@ -0,0 +1,53 @@
+package ceph
+
+import (
+	"context"
+
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	log "github.com/sirupsen/logrus"
+)
+
+func dataSourceCephVolume() *schema.Resource {
+	s := dataSourceSchemaFromResource(resourceCephVolume().Schema, "allow_shrink", "rollback_snapshot_name", "copy_from", "clone_mode",
+		"deletion_policy", "trash_delay", "restore_from_trash", "force_flatten_children")
+	s["pool_id"] = &schema.Schema{
+		Type:         schema.TypeString,
+		Required:     true,
+		Description:  "$cluster_name/$pool_name",
+		ValidateFunc: validation.NoZeroValues,
+	}
+	s["namespace"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Optional:    true,
+		Description: "rbd namespace of the pool",
+	}
+	s["name"] = &schema.Schema{
+		Type:         schema.TypeString,
+		Required:     true,
+		ValidateFunc: validation.NoZeroValues,
+	}
+	return &schema.Resource{
+		ReadContext: dataSourceCephVolumeRead,
+		Schema:      s,
+	}
+}
+
+func dataSourceCephVolumeRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("read data source ceph_volume")
+	cluster, poolName, err := sdk.ParseCephPool(d.Get("pool_id").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	id := sdk.FormatCephVol(cluster, poolName, d.Get("namespace").(string), d.Get("name").(string))
+	d.SetId(id)
+	if diags = resourceCephVolumeRead(ctx, d, meta); diags.HasError() {
+		return diags
+	} else if d.Id() == "" {
+		return diag.Errorf("volume '%s' not found", id)
+	}
+	return diags
+}
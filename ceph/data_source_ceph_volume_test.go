@@ -0,0 +1,31 @@
+package ceph
+
+import (
+	"testing"
+)
+
+func TestDataSourceCephVolume(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	vol, _ := client.CreateVol("pool1", "", "golden", 1024, nil)
+	vol.Close()
+
+	state, err := testReadData(dataSourceCephVolume(), map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "golden",
+	}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "id", "ceph/pool1/golden")
+	testCheckAttr(t, state, "size", "1024")
+	testCheckAttr(t, state, "features.#", "5")
+
+	if _, err = testReadData(dataSourceCephVolume(), map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "missing",
+	}, meta); err == nil {
+		t.Fatal("expect error reading a missing volume")
+	}
+}
@@ -0,0 +1,97 @@
+package ceph
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	log "github.com/sirupsen/logrus"
+)
+
+func dataSourceCephVolumes() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceCephVolumesRead,
+		Schema: map[string]*schema.Schema{
+			"pool_id": {
+				Type:         schema.TypeString,
+				Required:     true,
+				Description:  "$cluster_name/$pool_name",
+				ValidateFunc: validation.NoZeroValues,
+			},
+			"namespace": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "rbd namespace of the pool, default is the pool itself",
+			},
+			"prefix": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"name_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringIsValidRegExp,
+			},
+			"names": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"ids": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "$cluster_name/$pool_name/[$namespace/]$volume_name of the volumes",
+			},
+		},
+	}
+}
+
+func dataSourceCephVolumesRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("read data source ceph_volumes")
+	poolID := d.Get("pool_id").(string)
+	cluster, poolName, err := sdk.ParseCephPool(poolID)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var re *regexp.Regexp
+	if tmp, ok := d.GetOk("name_regex"); ok {
+		re = regexp.MustCompile(tmp.(string))
+	}
+	prefix := d.Get("prefix").(string)
+
+	namespace := d.Get("namespace").(string)
+	id := poolID
+	if namespace != "" {
+		id = fmt.Sprintf("%s/%s", poolID, namespace)
+	}
+	all, err := client.ListVols(poolName, namespace)
+	if err != nil {
+		return diag.Errorf("list volumes of '%s' failed: %v", id, err)
+	}
+	names := make([]string, 0, len(all))
+	ids := make([]string, 0, len(all))
+	for _, name := range all {
+		if !strings.HasPrefix(name, prefix) || (re != nil && !re.MatchString(name)) {
+			continue
+		}
+		names = append(names, name)
+		ids = append(ids, sdk.FormatCephVol(cluster, poolName, namespace, name))
+	}
+
+	d.SetId(id)
+	_ = d.Set("names", names)
+	_ = d.Set("ids", ids)
+	return nil
+}
@@ -0,0 +1,46 @@
+package ceph
+
+import (
+	"testing"
+)
+
+func TestDataSourceCephVolumes(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	for _, name := range []string{"golden-ubuntu", "golden-centos", "vm1"} {
+		_, _ = client.CreateVol("pool1", "", name, 1024, nil)
+	}
+	r := dataSourceCephVolumes()
+
+	state, err := testReadData(r, map[string]interface{}{"pool_id": "ceph/pool1"}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "names.#", "3")
+
+	state, err = testReadData(r, map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"prefix":  "golden-",
+	}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "names.#", "2")
+	testCheckAttr(t, state, "names.0", "golden-centos")
+	testCheckAttr(t, state, "ids.1", "ceph/pool1/golden-ubuntu")
+
+	state, err = testReadData(r, map[string]interface{}{
+		"pool_id":    "ceph/pool1",
+		"name_regex": "ubuntu$",
+	}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "names.#", "1")
+	testCheckAttr(t, state, "names.0", "golden-ubuntu")
+
+	if _, err = testReadData(r, map[string]interface{}{"pool_id": "ceph/pool2"}, meta); err == nil {
+		t.Fatal("expect error listing a missing pool")
+	}
+}
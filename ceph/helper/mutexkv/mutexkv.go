@@ -1,6 +1,8 @@
 package mutexkv
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"sync"
 )
@@ -11,33 +13,52 @@ import (
 //
 // The initial use case is to let aws_security_group_rule resources serialize
 // their access to individual security groups based on SG ID.
+//
+// The mutexes are channels with a buffer of one, so that waiting for them can
+// be given up by LockContext.
 type MutexKV struct {
 	lock  sync.Mutex
-	store map[string]*sync.Mutex
+	store map[string]chan struct{}
 }
 
 // Locks the mutex for the given key. Caller is responsible for calling Unlock
 // for the same key
 func (m *MutexKV) Lock(key string) {
+	_ = m.LockContext(context.Background(), key)
+}
+
+// LockContext locks the mutex for the given key like Lock, it gives up when
+// ctx is done first. Caller must call Unlock only if no error is returned.
+func (m *MutexKV) LockContext(ctx context.Context, key string) error {
 	log.Printf("[DEBUG] Locking %q", key)
-	m.get(key).Lock()
-	log.Printf("[DEBUG] Locked %q", key)
+	select {
+	case m.get(key) <- struct{}{}:
+		log.Printf("[DEBUG] Locked %q", key)
+		return nil
+	case <-ctx.Done():
+		log.Printf("[DEBUG] Gave up locking %q: %v", key, ctx.Err())
+		return fmt.Errorf("wait for lock %q: %w", key, ctx.Err())
+	}
 }
 
 // Unlock the mutex for the given key. Caller must have called Lock for the same key first
 func (m *MutexKV) Unlock(key string) {
 	log.Printf("[DEBUG] Unlocking %q", key)
-	m.get(key).Unlock()
+	select {
+	case <-m.get(key):
+	default:
+		panic(fmt.Sprintf("mutexkv: unlock of unlocked key %q", key))
+	}
 	log.Printf("[DEBUG] Unlocked %q", key)
 }
 
 // Returns a mutex for the given key, no guarantee of its lock status
-func (m *MutexKV) get(key string) *sync.Mutex {
+func (m *MutexKV) get(key string) chan struct{} {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	mutex, ok := m.store[key]
 	if !ok {
-		mutex = &sync.Mutex{}
+		mutex = make(chan struct{}, 1)
 		m.store[key] = mutex
 	}
 	return mutex
@@ -46,6 +67,6 @@ func (m *MutexKV) get(key string) *sync.Mutex {
 // Returns a properly initalized MutexKV
 func NewMutexKV() *MutexKV {
 	return &MutexKV{
-		store: make(map[string]*sync.Mutex),
+		store: make(map[string]chan struct{}),
 	}
 }
@@ -1,6 +1,8 @@
 package mutexkv
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 )
@@ -65,3 +67,20 @@ func TestMutexKVDifferentKeys(t *testing.T) {
 		t.Fatal("Second lock on a different key blocked. This shouldn't happen.")
 	}
 }
+
+func TestMutexKVLockContext(t *testing.T) {
+	mkv := NewMutexKV()
+
+	mkv.Lock("foo")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := mkv.LockContext(ctx, "foo"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected to give up locking after the deadline, got %v", err)
+	}
+
+	mkv.Unlock("foo")
+	if err := mkv.LockContext(context.Background(), "foo"); err != nil {
+		t.Fatalf("Lock after unlock failed: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// JsonMarshal marshal v with encoding/json compatible config
+func JsonMarshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// JsonUnmarshal unmarshal data with encoding/json compatible config
+func JsonUnmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GetValFromJson get value from json data by path, e.g. ("health", "status")
+func GetValFromJson(data []byte, path ...interface{}) jsoniter.Any {
+	return json.Get(data, path...)
+}
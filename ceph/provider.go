@@ -2,12 +2,17 @@ package ceph
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"regexp"
+	"sort"
 	"strings"
 	"terraform-provider-ceph/ceph/sdk"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -16,28 +21,123 @@ func Provider() *schema.Provider {
 	return &schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"cluster": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "ceph clusters for operations, the clusters in CEPH_CLUSTER (default ceph) are used if not set",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringMatch(regexp.MustCompile(`^[^/\s,]+$`), "must not be empty, contain spaces, commas or slashes"),
+						},
+						"mon_host": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"user": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"key": {
+							Type:      schema.TypeString,
+							Optional:  true,
+							Sensitive: true,
+						},
+						"keyring": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "path of the keyring",
+						},
+						"config_path": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"config_overrides": {
+							Type:     schema.TypeMap,
+							Optional: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+			},
+			"mon_host": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CEPH_MON_HOST", nil),
+				Description: "monitor addresses, no config file is read if set without `config_path`",
+			},
+			"user": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("CEPH_USER", nil),
+				ConflictsWith: []string{"client_id"},
+				Description:   "ceph user without the `client.` prefix, default is admin",
+			},
+			"client_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"user"},
+				Description:   "alias of `user`, like `--id` of the ceph cli",
+			},
+			"key": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				DefaultFunc:   schema.EnvDefaultFunc("CEPH_KEY", nil),
+				ConflictsWith: []string{"keyring_path"},
+				Description:   "cephx key of the user",
+			},
+			"keyring_path": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CEPH_KEYRING", nil),
+			},
+			"config_path": {
 				Type:        schema.TypeString,
-				Required:    true,
-				DefaultFunc: schema.EnvDefaultFunc("CEPH_CLUSTER", nil),
-				Description: "ceph cluster for operations",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CEPH_CONF", nil),
+				Description: "config file, default is /etc/ceph/$cluster.conf",
+			},
+			"config_overrides": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "config options set after reading the config file, e.g. `rados_osd_op_timeout`",
 			},
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
 			//"ceph_mon":      resourceCephMon(),
-			"ceph_pool":     resourceCephPool(),
-			"ceph_volume":   resourceCephVolume(),
-			"ceph_snapshot": resourceCephSnapshot(),
+			"ceph_pool":                 resourceCephPool(),
+			"ceph_volume":               resourceCephVolume(),
+			"ceph_snapshot":             resourceCephSnapshot(),
+			"ceph_erasure_code_profile": resourceCephErasureCodeProfile(),
+			"ceph_client_user":          resourceCephClientUser(),
+			"ceph_rbd_namespace":        resourceCephRBDNamespace(),
+			"ceph_rbd_mirror_pool":      resourceCephRBDMirrorPool(),
 		},
 
-		DataSourcesMap: map[string]*schema.Resource{},
+		DataSourcesMap: map[string]*schema.Resource{
+			"ceph_pool":          dataSourceCephPool(),
+			"ceph_volume":        dataSourceCephVolume(),
+			"ceph_volumes":       dataSourceCephVolumes(),
+			"ceph_snapshot":      dataSourceCephSnapshot(),
+			"ceph_trash_entries": dataSourceCephTrashEntries(),
+		},
 
 		ConfigureContextFunc: providerConfigure,
 	}
 }
 
-// uri -> client for multi instance support
-// (we share the same client for the same uri)
+// NewCephClient connects to a cluster, main sets it to the go-ceph backend so
+// that this package builds without cgo, tests swap it for an in-memory one
+var NewCephClient = func(config *sdk.ConnConfig) (sdk.CephClientI, error) {
+	return nil, errors.New("the provider is built without a ceph backend")
+}
+
+// connection -> client for multi instance support
+// (we share the same client for the same connection settings)
 var globalClientMap = make(ClusterClient)
 
 // CleanupCephConnections closes ceph clients for all ceph clusters
@@ -49,32 +149,112 @@ func CleanupCephConnections() {
 }
 
 func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
-	config := Config{
-		Clusters: strings.Split(d.Get("cluster").(string), ","),
+	defaults := sdk.ConnConfig{
+		User:            d.Get("user").(string),
+		MonHost:         d.Get("mon_host").(string),
+		Key:             d.Get("key").(string),
+		Keyring:         d.Get("keyring_path").(string),
+		ConfigPath:      d.Get("config_path").(string),
+		ConfigOverrides: make(map[string]string),
+	}
+	if clientID, ok := d.GetOk("client_id"); ok {
+		defaults.User = clientID.(string)
+	}
+	for k, v := range d.Get("config_overrides").(map[string]interface{}) {
+		defaults.ConfigOverrides[k] = v.(string)
+	}
+
+	config, err := expandClusters(d.Get("cluster").([]interface{}), defaults)
+	if err != nil {
+		return nil, diag.FromErr(err)
 	}
 
-	for _, cluster := range config.Clusters {
-		if client, ok := globalClientMap[cluster]; ok && client.Conn != nil {
-			log.Debugf("reusing connection for ceph cluster: '%s'", cluster)
-			return globalClientMap, nil
+	clusterClient := make(ClusterClient, len(config.Clusters))
+	for _, conn := range config.Clusters {
+		key := connKey(conn)
+		if client, ok := globalClientMap[key]; ok && client != nil {
+			log.Debugf("reusing connection for ceph cluster: '%s'", key)
+			clusterClient[conn.Cluster] = client
+			continue
 		}
 
-		client, err := sdk.NewCephClient(cluster)
+		client, err := NewCephClient(conn)
 		if err != nil {
-			return nil, diag.FromErr(err)
+			return nil, diag.Errorf("connect to ceph cluster '%s' failed: %v", conn.Cluster, err)
 		}
-		globalClientMap[cluster] = client
-		log.Infof("created connection for ceph client: %s", cluster)
+		globalClientMap[key] = client
+		clusterClient[conn.Cluster] = client
+		log.Infof("created connection for ceph client: %s", key)
 	}
 
-	return globalClientMap, nil
+	return clusterClient, nil
 }
 
-func getClient(cluster string, meta interface{}) (*sdk.CephClient, error) {
+// expandClusters returns the settings of the cluster blocks, or of the
+// clusters in CEPH_CLUSTER without blocks
+func expandClusters(blocks []interface{}, defaults sdk.ConnConfig) (*Config, error) {
+	config := &Config{}
+	if len(blocks) == 0 {
+		names := os.Getenv("CEPH_CLUSTER")
+		if names == "" {
+			names = "ceph"
+		}
+		for _, name := range strings.Split(names, ",") {
+			conn := defaults
+			conn.Cluster = strings.TrimSpace(name)
+			config.Clusters = append(config.Clusters, &conn)
+		}
+		return config, nil
+	}
+
+	seen := make(map[string]bool, len(blocks))
+	for _, block := range blocks {
+		m := block.(map[string]interface{})
+		conn := defaults
+		conn.Cluster = m["name"].(string)
+		if seen[conn.Cluster] {
+			return nil, fmt.Errorf("cluster '%s' is configured more than once", conn.Cluster)
+		}
+		seen[conn.Cluster] = true
+
+		if key, keyring := m["key"].(string), m["keyring"].(string); key != "" && keyring != "" {
+			return nil, fmt.Errorf("cluster '%s': only one of `key` and `keyring` can be set", conn.Cluster)
+		} else if key != "" || keyring != "" {
+			conn.Key, conn.Keyring = key, keyring
+		}
+		for attr, field := range map[string]*string{
+			"mon_host":    &conn.MonHost,
+			"user":        &conn.User,
+			"config_path": &conn.ConfigPath,
+		} {
+			if v := m[attr].(string); v != "" {
+				*field = v
+			}
+		}
+		conn.ConfigOverrides = make(map[string]string, len(defaults.ConfigOverrides))
+		for k, v := range defaults.ConfigOverrides {
+			conn.ConfigOverrides[k] = v
+		}
+		for k, v := range m["config_overrides"].(map[string]interface{}) {
+			conn.ConfigOverrides[k] = v.(string)
+		}
+		config.Clusters = append(config.Clusters, &conn)
+	}
+	return config, nil
+}
+
+// getClient returns the client of the cluster, its calls give up when ctx is done
+func getClient(ctx context.Context, cluster string, meta interface{}) (sdk.CephClientI, error) {
 	clusterClient := meta.(ClusterClient)
 	client, ok := clusterClient[cluster]
-	if !ok || (ok && client.Conn == nil) {
-		return nil, fmt.Errorf(CephConIsNil)
+	if !ok || client == nil {
+		configured := make([]string, 0, len(clusterClient))
+		for name := range clusterClient {
+			configured = append(configured, name)
+		}
+		sort.Strings(configured)
+		return nil, fmt.Errorf("ceph cluster '%s' is not configured in the provider, configured clusters: %s",
+			cluster, strings.Join(configured, ", "))
 	}
-	return client, nil
+	return client.WithContext(ctx), nil
 }
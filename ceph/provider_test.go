@@ -0,0 +1,280 @@
+package ceph
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"terraform-provider-ceph/ceph/sdk"
+	"terraform-provider-ceph/ceph/sdk/fake"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestProvider(t *testing.T) {
+	if err := Provider().InternalValidate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+// testConfigure configures the provider with raw config, the connection
+// settings of every cluster are returned instead of connecting
+func testConfigure(t *testing.T, raw map[string]interface{}) ([]*sdk.ConnConfig, diag.Diagnostics) {
+	t.Helper()
+	var configs []*sdk.ConnConfig
+	oldNewCephClient, oldClientMap := NewCephClient, globalClientMap
+	NewCephClient = func(config *sdk.ConnConfig) (sdk.CephClientI, error) {
+		configs = append(configs, config)
+		return fake.NewCephClient(config.Cluster), nil
+	}
+	globalClientMap = make(ClusterClient)
+	defer func() {
+		NewCephClient, globalClientMap = oldNewCephClient, oldClientMap
+	}()
+
+	p := Provider()
+	config := terraform.NewResourceConfigRaw(raw)
+	if diags := p.Validate(config); diags.HasError() {
+		return nil, diags
+	}
+	return configs, p.Configure(context.Background(), config)
+}
+
+func TestProviderConfigure(t *testing.T) {
+	defer os.Setenv("CEPH_CLUSTER", os.Getenv("CEPH_CLUSTER"))
+	_ = os.Setenv("CEPH_CLUSTER", "ceph,dr")
+	configs, diags := testConfigure(t, map[string]interface{}{
+		"mon_host": "10.0.0.1,10.0.0.2",
+		"user":     "terraform",
+		"key":      "AQBhbWFjaGluZS1rZXk=",
+		"config_overrides": map[string]interface{}{
+			"rados_osd_op_timeout": "30",
+		},
+	})
+	if err := diagsErr(diags); err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 || configs[0].Cluster != "ceph" || configs[1].Cluster != "dr" {
+		t.Fatalf("expect clusters ceph and dr, got %v", configs)
+	}
+	config := configs[1]
+	if config.MonHost != "10.0.0.1,10.0.0.2" || config.User != "terraform" || config.Key != "AQBhbWFjaGluZS1rZXk=" {
+		t.Fatalf("unexpected connection settings %#v", config)
+	}
+	if config.ConfigOverrides["rados_osd_op_timeout"] != "30" {
+		t.Fatalf("expect config overrides, got %v", config.ConfigOverrides)
+	}
+
+	_ = os.Setenv("CEPH_CLUSTER", "")
+	configs, diags = testConfigure(t, map[string]interface{}{
+		"client_id":    "hv01",
+		"keyring_path": "/etc/ceph/ceph.client.hv01.keyring",
+		"config_path":  "/tmp/ceph.conf",
+	})
+	if err := diagsErr(diags); err != nil {
+		t.Fatal(err)
+	}
+	if config = configs[0]; config.Cluster != "ceph" || config.User != "hv01" ||
+		config.Keyring != "/etc/ceph/ceph.client.hv01.keyring" || config.ConfigPath != "/tmp/ceph.conf" {
+		t.Fatalf("unexpected connection settings %#v", config)
+	}
+
+	if _, diags = testConfigure(t, map[string]interface{}{
+		"key":          "AQBhbWFjaGluZS1rZXk=",
+		"keyring_path": "/etc/ceph/ceph.client.admin.keyring",
+	}); diagsErr(diags) == nil {
+		t.Fatal("expect error with both key and keyring_path")
+	}
+}
+
+func TestProviderConfigure_Clusters(t *testing.T) {
+	configs, diags := testConfigure(t, map[string]interface{}{
+		"user": "terraform",
+		"config_overrides": map[string]interface{}{
+			"rados_osd_op_timeout": "30",
+		},
+		"cluster": []interface{}{
+			map[string]interface{}{
+				"name":     "prod",
+				"mon_host": "10.0.0.1",
+				"key":      "AQBwcm9kLWtleQ==",
+			},
+			map[string]interface{}{
+				"name":        "dr",
+				"user":        "dr-terraform",
+				"keyring":     "/etc/ceph/dr.client.dr-terraform.keyring",
+				"config_path": "/etc/ceph/dr.conf",
+				"config_overrides": map[string]interface{}{
+					"rados_mon_op_timeout": "10",
+				},
+			},
+		},
+	})
+	if err := diagsErr(diags); err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("expect 2 clusters, got %v", configs)
+	}
+	prod, dr := configs[0], configs[1]
+	if prod.Cluster != "prod" || prod.MonHost != "10.0.0.1" || prod.User != "terraform" || prod.Key != "AQBwcm9kLWtleQ==" {
+		t.Fatalf("unexpected settings of prod %#v", prod)
+	}
+	if dr.Cluster != "dr" || dr.User != "dr-terraform" || dr.Key != "" || dr.ConfigPath != "/etc/ceph/dr.conf" {
+		t.Fatalf("unexpected settings of dr %#v", dr)
+	}
+	if len(dr.ConfigOverrides) != 2 || len(prod.ConfigOverrides) != 1 {
+		t.Fatalf("expect config overrides to be merged, got %v and %v", prod.ConfigOverrides, dr.ConfigOverrides)
+	}
+
+	if _, diags = testConfigure(t, map[string]interface{}{
+		"cluster": []interface{}{
+			map[string]interface{}{"name": "prod"},
+			map[string]interface{}{"name": "prod"},
+		},
+	}); diagsErr(diags) == nil {
+		t.Fatal("expect error with a cluster configured twice")
+	}
+	if _, diags = testConfigure(t, map[string]interface{}{
+		"cluster": []interface{}{
+			map[string]interface{}{"name": "prod", "key": "AQBwcm9kLWtleQ==", "keyring": "/etc/ceph/prod.keyring"},
+		},
+	}); diagsErr(diags) == nil {
+		t.Fatal("expect error with both key and keyring")
+	}
+}
+
+func TestConnKey(t *testing.T) {
+	a := connKey(&sdk.ConnConfig{Cluster: "ceph", User: "terraform", Key: "AQBhbWFjaGluZS1rZXk="})
+	b := connKey(&sdk.ConnConfig{Cluster: "ceph", User: "terraform", Key: "AQBvdGhlci1rZXk="})
+	if a == b {
+		t.Fatalf("expect connections with other keys not to be shared, got %s", a)
+	}
+	if strings.Contains(a, "AQBhbWFjaGluZS1rZXk=") {
+		t.Fatalf("expect the key to be left out, got %s", a)
+	}
+}
+
+func TestProviderGetClient(t *testing.T) {
+	meta := testMeta("prod", "dr")
+	if _, err := getClient(context.Background(), "prod", meta); err != nil {
+		t.Fatal(err)
+	}
+	_, err := getClient(context.Background(), "ceph", meta)
+	if err == nil || err.Error() != "ceph cluster 'ceph' is not configured in the provider, configured clusters: dr, prod" {
+		t.Fatalf("expect error naming the configured clusters, got %v", err)
+	}
+}
+
+// testMeta returns the provider meta backed by in-memory clusters
+func testMeta(clusters ...string) ClusterClient {
+	meta := make(ClusterClient)
+	for _, cluster := range clusters {
+		meta[cluster] = fake.NewCephClient(cluster)
+	}
+	return meta
+}
+
+// testFakeClient returns the in-memory client of cluster
+func testFakeClient(t *testing.T, meta ClusterClient, cluster string) *fake.CephClient {
+	t.Helper()
+	client, ok := meta[cluster].(*fake.CephClient)
+	if !ok {
+		t.Fatalf("cluster '%s' is not configured", cluster)
+	}
+	return client
+}
+
+// testImport imports the resource by id and refreshes it like `terraform import`
+func testImport(r *schema.Resource, id string, meta interface{}) (*terraform.InstanceState, error) {
+	ctx := context.Background()
+	data, err := r.Importer.StateContext(ctx, r.Data(&terraform.InstanceState{ID: id}), meta)
+	if err != nil {
+		return nil, err
+	}
+	state := data[0].State()
+	state, diags := r.RefreshWithoutUpgrade(ctx, state, meta)
+	return state, diagsErr(diags)
+}
+
+// testApply plans raw config against state and applies the diff, the same
+// way terraform core drives a resource during `terraform apply`
+func testApply(r *schema.Resource, state *terraform.InstanceState, raw map[string]interface{}, meta interface{}) (*terraform.InstanceState, error) {
+	ctx := context.Background()
+	config := terraform.NewResourceConfigRaw(raw)
+	if err := diagsErr(r.Validate(config)); err != nil {
+		return state, err
+	}
+	diff, err := r.Diff(ctx, state, config, meta)
+	if err != nil {
+		return state, err
+	} else if diff == nil || diff.Empty() {
+		return state, nil
+	}
+	newState, diags := r.Apply(ctx, state, diff, meta)
+	return newState, diagsErr(diags)
+}
+
+// testPlan returns the diff between raw config and state
+func testPlan(t *testing.T, r *schema.Resource, state *terraform.InstanceState, raw map[string]interface{}, meta interface{}) *terraform.InstanceDiff {
+	t.Helper()
+	diff, err := r.Diff(context.Background(), state, terraform.NewResourceConfigRaw(raw), meta)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	return diff
+}
+
+// testRefresh reads the resource, a nil state means it's gone
+func testRefresh(t *testing.T, r *schema.Resource, state *terraform.InstanceState, meta interface{}) *terraform.InstanceState {
+	t.Helper()
+	newState, diags := r.RefreshWithoutUpgrade(context.Background(), state, meta)
+	if err := diagsErr(diags); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	return newState
+}
+
+// testDestroy destroys the resource like `terraform destroy`
+func testDestroy(r *schema.Resource, state *terraform.InstanceState, meta interface{}) error {
+	_, diags := r.Apply(context.Background(), state, &terraform.InstanceDiff{Destroy: true}, meta)
+	return diagsErr(diags)
+}
+
+// testMustApply is testApply failing the test on error
+func testMustApply(t *testing.T, r *schema.Resource, state *terraform.InstanceState, raw map[string]interface{}, meta interface{}) *terraform.InstanceState {
+	t.Helper()
+	newState, err := testApply(r, state, raw, meta)
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	return newState
+}
+
+func testCheckAttr(t *testing.T, state *terraform.InstanceState, key, value string) {
+	t.Helper()
+	if state == nil {
+		t.Fatalf("resource not exists, expect %s = %q", key, value)
+	}
+	if v := state.Attributes[key]; v != value {
+		t.Fatalf("expect %s = %q, got %q", key, value, v)
+	}
+}
+
+// testReadData reads a data source with raw config like `terraform refresh`
+func testReadData(r *schema.Resource, raw map[string]interface{}, meta interface{}) (*terraform.InstanceState, error) {
+	ctx := context.Background()
+	config := terraform.NewResourceConfigRaw(raw)
+	if err := diagsErr(r.Validate(config)); err != nil {
+		return nil, err
+	}
+	diff, err := r.Diff(ctx, nil, config, meta)
+	if err != nil {
+		return nil, err
+	}
+	state, diags := r.ReadDataApply(ctx, diff, meta)
+	return state, diagsErr(diags)
+}
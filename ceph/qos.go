@@ -0,0 +1,121 @@
+package ceph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// qosOptions are the keys of qos maps, each one is the librbd option
+// rbd_qos_$name
+var qosOptions = []string{
+	"iops_limit",
+	"iops_burst",
+	"read_iops_limit",
+	"read_iops_burst",
+	"write_iops_limit",
+	"write_iops_burst",
+	"bps_limit",
+	"bps_burst",
+	"read_bps_limit",
+	"read_bps_burst",
+	"write_bps_limit",
+	"write_bps_burst",
+}
+
+// qosConfigKey returns the metadata key of the config override of a qos option
+func qosConfigKey(name string) string {
+	return sdk.ConfMetadataPrefix + "rbd_qos_" + name
+}
+
+// qosSchema is a map of config overrides, like `rbd config image set` or
+// `rbd config pool set` of the rbd_qos_* options. It's a map rather than a
+// block so that an option set to 0, which is unlimited and overrides the
+// limit of the pool or the cluster, is told apart from an unset one, which
+// inherits it. A computed one isn't managed if unset.
+func qosSchema(description string, computed bool) *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeMap,
+		Optional:     true,
+		Computed:     computed,
+		Elem:         &schema.Schema{Type: schema.TypeInt},
+		Description:  description,
+		ValidateFunc: validateQos,
+	}
+}
+
+// validateQos accepts the qos options with values of at least 0
+func validateQos(i interface{}, k string) (warnings []string, errors []error) {
+	v, ok := i.(map[string]interface{})
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be map", k)}
+	}
+	known := make(map[string]bool, len(qosOptions))
+	for _, name := range qosOptions {
+		known[name] = true
+	}
+	for key, value := range v {
+		if !known[key] {
+			errors = append(errors, fmt.Errorf("expected %s to contain only %s, got %q", k, strings.Join(qosOptions, ", "), key))
+		} else if n, ok := value.(int); ok && n < 0 {
+			errors = append(errors, fmt.Errorf("expected %s.%s to be at least (0), got %d", k, key, n))
+		}
+	}
+	return nil, errors
+}
+
+// expandQos returns the config overrides of the qos map, explicit zeros
+// included
+func expandQos(d *schema.ResourceData) map[string]string {
+	overrides := make(map[string]string)
+	for name, value := range d.Get("qos").(map[string]interface{}) {
+		overrides[qosConfigKey(name)] = strconv.Itoa(value.(int))
+	}
+	return overrides
+}
+
+// flattenQos returns the qos map of the config overrides in metadata
+func flattenQos(metadata map[string]string) (map[string]interface{}, error) {
+	qos := make(map[string]interface{})
+	for _, name := range qosOptions {
+		value, ok := metadata[qosConfigKey(name)]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", qosConfigKey(name), value)
+		}
+		qos[name] = n
+	}
+	return qos, nil
+}
+
+// updateQos changes the qos config overrides in current to the ones of qos,
+// other config overrides are left alone
+func updateQos(current, qos map[string]string, target string, set func(key, value string) error, remove func(key string) error) error {
+	for key := range current {
+		if _, ok := qos[key]; ok || !strings.HasPrefix(key, qosConfigKey("")) {
+			continue
+		}
+		log.Infof("remove %s of %s", strings.TrimPrefix(key, sdk.ConfMetadataPrefix), target)
+		if err := remove(key); err != nil {
+			return fmt.Errorf("remove %s of %s failed: %v", strings.TrimPrefix(key, sdk.ConfMetadataPrefix), target, err)
+		}
+	}
+	for key, value := range qos {
+		if current[key] == value {
+			continue
+		}
+		log.Infof("set %s of %s: %s", strings.TrimPrefix(key, sdk.ConfMetadataPrefix), target, value)
+		if err := set(key, value); err != nil {
+			return fmt.Errorf("set %s of %s failed: %v", strings.TrimPrefix(key, sdk.ConfMetadataPrefix), target, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package ceph
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	log "github.com/sirupsen/logrus"
+)
+
+func resourceCephClientUser() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceCephClientUserCreate,
+		ReadContext:   resourceCephClientUserRead,
+		UpdateContext: resourceCephClientUserUpdate,
+		DeleteContext: resourceCephClientUserDelete,
+		Schema: map[string]*schema.Schema{
+			"cluster": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "ceph",
+				ForceNew: true,
+			},
+			"name": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				Description:  "the user is client.$name",
+				ValidateFunc: validation.StringMatch(regexp.MustCompile(`^[^.\s/][^\s/]*$`), "must not be empty, contain spaces or slashes"),
+			},
+			"caps": {
+				Type:     schema.TypeMap,
+				Required: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Description:      "capabilities by daemon type (mon, osd, mgr, mds), e.g. `osd = \"profile rbd pool=vms\"`",
+				ValidateDiagFunc: validation.MapKeyMatch(regexp.MustCompile(`^(mon|osd|mgr|mds)$`), "daemon type must be one of mon, osd, mgr or mds"),
+			},
+			"key": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+		},
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceCephClientUserImport,
+		},
+	}
+}
+
+func expandClientUserCaps(d *schema.ResourceData) map[string]string {
+	caps := make(map[string]string)
+	for k, v := range d.Get("caps").(map[string]interface{}) {
+		caps[k] = v.(string)
+	}
+	return caps
+}
+
+func resourceCephClientUserCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("create resource ceph_client_user")
+	cluster := d.Get("cluster").(string)
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	name := strings.TrimSpace(d.Get("name").(string))
+	key := fmt.Sprintf("%s/%s", cluster, name)
+	if err = client.GetMutexKV().LockContext(ctx, key); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(key)
+
+	caps := expandClientUserCaps(d)
+	user, err := client.GetClientUser(name)
+	if err != nil {
+		return diag.FromErr(err)
+	} else if user == nil {
+		log.Infof("create user 'client.%s' of cluster %s ...", name, cluster)
+		if _, err = client.CreateClientUser(name, caps); err != nil {
+			return diag.FromErr(err)
+		}
+	} else {
+		log.Infof("user 'client.%s' of cluster %s already exists, set caps ...", name, cluster)
+		if err = client.SetClientUserCaps(name, caps); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	d.SetId(key)
+	log.Infof("Client user ID: %s", d.Id())
+	return resourceCephClientUserRead(ctx, d, meta)
+}
+
+// resourceCephClientUserImport imports users by {cluster}/{name} without the client. prefix
+func resourceCephClientUserImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	cluster, name, err := parseClusterID(normalizeImportID(d.Id()), "client user", "user_name")
+	if err != nil {
+		return nil, err
+	}
+	name = strings.TrimPrefix(name, "client.")
+	return importByRead(ctx, d, meta, "client user", fmt.Sprintf("%s/%s", cluster, name), resourceCephClientUserRead)
+}
+
+func resourceCephClientUserRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("read resource ceph_client_user")
+	cluster, name, err := parseClusterID(d.Id(), "client user", "user_name")
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	user, err := client.GetClientUser(name)
+	if err != nil {
+		return diag.FromErr(err)
+	} else if user == nil {
+		log.Warnf("client user '%s' may have been deleted outside Terraform", d.Id())
+		d.SetId("")
+		return nil
+	}
+
+	_ = d.Set("cluster", cluster)
+	_ = d.Set("name", name)
+	_ = d.Set("caps", user.Caps)
+	_ = d.Set("key", user.Key)
+	return nil
+}
+
+func resourceCephClientUserUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("update resource ceph_client_user")
+	cluster := d.Get("cluster").(string)
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err = client.GetMutexKV().LockContext(ctx, d.Id()); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(d.Id())
+
+	if d.HasChange("caps") {
+		log.Infof("set caps of client user '%s' ...", d.Id())
+		if err = client.SetClientUserCaps(d.Get("name").(string), expandClientUserCaps(d)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	return resourceCephClientUserRead(ctx, d, meta)
+}
+
+func resourceCephClientUserDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("delete resource ceph_client_user")
+	cluster := d.Get("cluster").(string)
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err = client.GetMutexKV().LockContext(ctx, d.Id()); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(d.Id())
+
+	log.Infof("delete client user '%s' ...", d.Id())
+	return diag.FromErr(client.DeleteClientUser(d.Get("name").(string)))
+}
@@ -0,0 +1,120 @@
+package ceph
+
+import (
+	"testing"
+)
+
+func TestCephClientUser_Basic(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	r := resourceCephClientUser()
+	config := map[string]interface{}{
+		"name": "hv01",
+		"caps": map[string]interface{}{
+			"mon": "profile rbd",
+			"osd": "profile rbd pool=vms",
+		},
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	if state.ID != "ceph/hv01" {
+		t.Fatalf("expect id ceph/hv01, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "caps.osd", "profile rbd pool=vms")
+	user, _ := client.GetClientUser("hv01")
+	if user == nil || user.Caps["mon"] != "profile rbd" {
+		t.Fatalf("expect client.hv01 with caps, got %#v", user)
+	}
+	testCheckAttr(t, state, "key", user.Key)
+	if !r.Schema["key"].Sensitive {
+		t.Fatal("expect key to be sensitive")
+	}
+
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	config["caps"] = map[string]interface{}{
+		"mon": "profile rbd",
+		"osd": "profile rbd pool=vms, profile rbd-read-only pool=images",
+		"mgr": "profile rbd pool=vms",
+	}
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "caps.mgr", "profile rbd pool=vms")
+	testCheckAttr(t, state, "key", user.Key)
+
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := client.GetClientUser("hv01"); user != nil {
+		t.Fatal("client.hv01 not deleted")
+	}
+}
+
+func TestCephClientUser_CapsDrift(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	r := resourceCephClientUser()
+	config := map[string]interface{}{
+		"name": "hv01",
+		"caps": map[string]interface{}{"mon": "profile rbd"},
+	}
+	state := testMustApply(t, r, nil, config, meta)
+
+	_ = client.SetClientUserCaps("hv01", map[string]string{"mon": "allow *", "osd": "allow *"})
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "caps.osd", "allow *")
+	if diff := testPlan(t, r, state, config, meta); diff.Empty() {
+		t.Fatal("expect caps changed outside terraform to be planned")
+	}
+	state = testMustApply(t, r, state, config, meta)
+	if user, _ := client.GetClientUser("hv01"); len(user.Caps) != 1 || user.Caps["mon"] != "profile rbd" {
+		t.Fatalf("expect caps to be restored, got %v", user.Caps)
+	}
+
+	_ = client.DeleteClientUser("hv01")
+	if state = testRefresh(t, r, state, meta); state != nil {
+		t.Fatal("expect user deleted outside terraform to be removed from state")
+	}
+}
+
+func TestCephClientUser_InvalidCaps(t *testing.T) {
+	meta := testMeta("ceph")
+	r := resourceCephClientUser()
+
+	if _, err := testApply(r, nil, map[string]interface{}{
+		"name": "hv01",
+		"caps": map[string]interface{}{"rgw": "allow *"},
+	}, meta); err == nil {
+		t.Fatal("expect error with unknown daemon type")
+	}
+	if _, err := testApply(r, nil, map[string]interface{}{
+		"name": "hv01",
+		"caps": map[string]interface{}{"osd": "rwx pool=vms"},
+	}, meta); err == nil {
+		t.Fatal("expect error with invalid caps")
+	}
+}
+
+func TestCephClientUser_Import(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	user, _ := client.CreateClientUser("hv01", map[string]string{"mon": "profile rbd"})
+	r := resourceCephClientUser()
+
+	state, err := testImport(r, "ceph/client.hv01", meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.ID != "ceph/hv01" {
+		t.Fatalf("expect id ceph/hv01, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "caps.mon", "profile rbd")
+	testCheckAttr(t, state, "key", user.Key)
+
+	for _, id := range []string{"hv01", "ceph/", "ceph/hv02"} {
+		if _, err = testImport(r, id, meta); err == nil {
+			t.Fatalf("expect error importing '%s'", id)
+		}
+	}
+}
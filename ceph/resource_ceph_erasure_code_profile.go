@@ -0,0 +1,180 @@
+package ceph
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	log "github.com/sirupsen/logrus"
+)
+
+// erasureCodeProfileKeys maps attributes to the keys of the profile
+var erasureCodeProfileKeys = map[string]string{
+	"k":                    "k",
+	"m":                    "m",
+	"plugin":               "plugin",
+	"technique":            "technique",
+	"crush_failure_domain": "crush-failure-domain",
+	"crush_device_class":   "crush-device-class",
+}
+
+func resourceCephErasureCodeProfile() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceCephErasureCodeProfileCreate,
+		ReadContext:   resourceCephErasureCodeProfileRead,
+		DeleteContext: resourceCephErasureCodeProfileDelete,
+		Schema: map[string]*schema.Schema{
+			"cluster": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "ceph",
+				ForceNew: true,
+			},
+			"name": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.NoZeroValues,
+			},
+			"k": {
+				Type:         schema.TypeInt,
+				Required:     true,
+				ForceNew:     true,
+				Description:  "number of data chunks",
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"m": {
+				Type:         schema.TypeInt,
+				Required:     true,
+				ForceNew:     true,
+				Description:  "number of coding chunks",
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"plugin": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "jerasure",
+				ForceNew: true,
+			},
+			"technique": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+			},
+			"crush_failure_domain": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+			},
+			"crush_device_class": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+			},
+		},
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceCephErasureCodeProfileImport,
+		},
+	}
+}
+
+func resourceCephErasureCodeProfileCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("create resource ceph_erasure_code_profile")
+	cluster := d.Get("cluster").(string)
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	name := strings.TrimSpace(d.Get("name").(string))
+	key := fmt.Sprintf("%s/%s", cluster, name)
+	if err = client.GetMutexKV().LockContext(ctx, key); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(key)
+
+	profile := make(map[string]string)
+	for attr, k := range erasureCodeProfileKeys {
+		if tmp, ok := d.GetOk(attr); ok {
+			profile[k] = fmt.Sprint(tmp)
+		}
+	}
+
+	log.Infof("set erasure code profile '%s' ...", key)
+	if err = client.SetErasureCodeProfile(name, profile); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(key)
+	log.Infof("Erasure code profile ID: %s", d.Id())
+	return resourceCephErasureCodeProfileRead(ctx, d, meta)
+}
+
+// resourceCephErasureCodeProfileImport imports profiles by {cluster}/{name}
+func resourceCephErasureCodeProfileImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	cluster, name, err := parseClusterID(normalizeImportID(d.Id()), "erasure code profile", "profile_name")
+	if err != nil {
+		return nil, err
+	}
+	return importByRead(ctx, d, meta, "erasure code profile", fmt.Sprintf("%s/%s", cluster, name), resourceCephErasureCodeProfileRead)
+}
+
+func resourceCephErasureCodeProfileRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("read resource ceph_erasure_code_profile")
+	cluster, name, err := parseClusterID(d.Id(), "erasure code profile", "profile_name")
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	profile, err := client.GetErasureCodeProfile(name)
+	if err != nil {
+		return diag.FromErr(err)
+	} else if profile == nil {
+		log.Warnf("erasure code profile '%s' may have been deleted outside Terraform", d.Id())
+		d.SetId("")
+		return nil
+	}
+
+	_ = d.Set("cluster", cluster)
+	_ = d.Set("name", name)
+	for attr, k := range erasureCodeProfileKeys {
+		if attr == "k" || attr == "m" {
+			n, err := strconv.Atoi(profile[k])
+			if err != nil {
+				return diag.Errorf("erasure code profile '%s' invalid %s: %s", d.Id(), k, profile[k])
+			}
+			_ = d.Set(attr, n)
+		} else {
+			_ = d.Set(attr, profile[k])
+		}
+	}
+	return nil
+}
+
+func resourceCephErasureCodeProfileDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("delete resource ceph_erasure_code_profile")
+	cluster := d.Get("cluster").(string)
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err = client.GetMutexKV().LockContext(ctx, d.Id()); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(d.Id())
+
+	log.Infof("delete erasure code profile '%s' ...", d.Id())
+	return diag.FromErr(client.DeleteErasureCodeProfile(d.Get("name").(string)))
+}
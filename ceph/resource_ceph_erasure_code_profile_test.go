@@ -0,0 +1,79 @@
+package ceph
+
+import (
+	"testing"
+)
+
+func TestCephErasureCodeProfile_Basic(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	r := resourceCephErasureCodeProfile()
+	config := map[string]interface{}{
+		"name":                 "ec42",
+		"k":                    4,
+		"m":                    2,
+		"crush_failure_domain": "rack",
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	if state.ID != "ceph/ec42" {
+		t.Fatalf("expect id ceph/ec42, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "k", "4")
+	testCheckAttr(t, state, "m", "2")
+	testCheckAttr(t, state, "plugin", "jerasure")
+	testCheckAttr(t, state, "technique", "reed_sol_van")
+	testCheckAttr(t, state, "crush_failure_domain", "rack")
+
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	config["m"] = 3
+	if diff := testPlan(t, r, state, config, meta); !diff.RequiresNew() {
+		t.Fatal("expect profile to be replaced when m changes")
+	}
+
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	if profile, _ := client.GetErasureCodeProfile("ec42"); profile != nil {
+		t.Fatal("ec42 not deleted")
+	}
+}
+
+func TestCephErasureCodeProfile_InUse(t *testing.T) {
+	meta := testMeta("ceph")
+	r := resourceCephErasureCodeProfile()
+
+	state := testMustApply(t, r, nil, map[string]interface{}{"name": "ec21", "k": 2, "m": 1}, meta)
+	testMustApply(t, resourceCephPool(), nil, map[string]interface{}{
+		"name":                 "ecpool",
+		"pool_type":            "erasure",
+		"erasure_code_profile": "ec21",
+	}, meta)
+
+	if err := testDestroy(r, state, meta); err == nil {
+		t.Fatal("expect destroy to fail while a pool uses the profile")
+	}
+}
+
+func TestCephErasureCodeProfile_Import(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.SetErasureCodeProfile("ec42", map[string]string{"k": "4", "m": "2"})
+	r := resourceCephErasureCodeProfile()
+
+	state, err := testImport(r, "ceph/ec42", meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "k", "4")
+	testCheckAttr(t, state, "m", "2")
+
+	for _, id := range []string{"ec42", "ceph/ec42/x", "ceph/ec21"} {
+		if _, err = testImport(r, id, meta); err == nil {
+			t.Fatalf("expect error importing '%s'", id)
+		}
+	}
+}
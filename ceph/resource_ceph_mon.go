@@ -56,7 +56,7 @@ func resourceCephMon() *schema.Resource {
 func resourceCephMonCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("create resource ceph_mon")
 	cluster := d.Get("cluster").(string)
-	client, err := getClient(cluster, meta)
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -90,7 +90,7 @@ func resourceCephMonCreate(ctx context.Context, d *schema.ResourceData, meta int
 func resourceCephMonRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("read resource ceph_mon")
 	cluster := d.Id()[len(cephMonIDPrefix):]
-	_, err := getClient(cluster, meta)
+	_, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -118,7 +118,7 @@ func resourceCephMonRead(ctx context.Context, d *schema.ResourceData, meta inter
 func resourceCephMonUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("update resource ceph_mon")
 	cluster := d.Id()[len(cephMonIDPrefix):]
-	client, err := getClient(cluster, meta)
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -150,7 +150,7 @@ func resourceCephMonUpdate(ctx context.Context, d *schema.ResourceData, meta int
 func resourceCephMonDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("delete resource ceph_mon")
 	cluster := d.Id()[len(cephMonIDPrefix):]
-	_, err := getClient(cluster, meta)
+	_, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -3,9 +3,14 @@ package ceph
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
+
+	"terraform-provider-ceph/ceph/sdk"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	log "github.com/sirupsen/logrus"
@@ -15,7 +20,18 @@ func resourceCephPool() *schema.Resource {
 	return &schema.Resource{
 		CreateContext: resourceCephPoolCreate,
 		ReadContext:   resourceCephPoolRead,
+		UpdateContext: resourceCephPoolUpdate,
 		DeleteContext: resourceCephPoolDelete,
+		CustomizeDiff: customdiff.All(
+			resourceCephPoolValidateType,
+			resourceCephPoolValidateRBDInit,
+			customdiff.ValidateChange("allow_ec_overwrites", func(ctx context.Context, old, new, meta interface{}) error {
+				if old.(bool) && !new.(bool) {
+					return fmt.Errorf("`allow_ec_overwrites` can't be disabled once enabled")
+				}
+				return nil
+			}),
+		),
 		// Exists: resourceCephPoolExists,
 		Schema: map[string]*schema.Schema{
 			"cluster": {
@@ -31,6 +47,133 @@ func resourceCephPool() *schema.Resource {
 				ForceNew:     true,
 				ValidateFunc: validation.NoZeroValues,
 			},
+			"pool_type": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "replicated",
+				ForceNew:     true,
+				ValidateFunc: validation.StringInSlice([]string{"replicated", "erasure"}, false),
+			},
+			"erasure_code_profile": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				ForceNew:    true,
+				Description: "profile of erasure pool, ceph uses the `default` profile if not set",
+			},
+			"allow_ec_overwrites": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Computed:    true,
+				Description: "allow partial writes to erasure pool, required by rbd and cephfs, can't be disabled once enabled",
+			},
+			"size": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				Description:  "number of replicas, k+m for erasure pool",
+				ValidateFunc: validation.IntBetween(1, 10),
+			},
+			"min_size": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				Description:  "minimum number of replicas to serve I/O",
+				ValidateFunc: validation.IntBetween(1, 10),
+			},
+			"pg_num": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"pgp_num": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"pg_autoscale_mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice([]string{"on", "off", "warn"}, false),
+			},
+			"crush_rule": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"compression_mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice([]string{"none", "passive", "aggressive", "force"}, false),
+			},
+			"compression_algorithm": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice([]string{"none", "snappy", "zlib", "zstd", "lz4"}, false),
+			},
+			"compression_required_ratio": {
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				Computed:     true,
+				Description:  "compressed chunks larger than this ratio of the original size are stored uncompressed",
+				ValidateFunc: validation.FloatBetween(0, 1),
+			},
+			"compression_min_blob_size": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				Description:  "chunks smaller than this are never compressed",
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"compression_max_blob_size": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				Description:  "chunks larger than this are broken into smaller blobs before being compressed",
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"quota_max_bytes": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      0,
+				Description:  "maximum bytes stored in the pool, 0 is unlimited",
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"quota_max_objects": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      0,
+				Description:  "maximum number of objects in the pool, 0 is unlimited",
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"application": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.StringLenBetween(1, 128),
+				},
+				Description: "applications enabled on the pool, e.g. rbd, rgw, cephfs or a custom one, not managed if unset",
+			},
+			"rbd_init": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "initialize the pool for rbd like `rbd pool init`, requires rbd in `application`",
+			},
+			"qos": qosSchema("io limits of the rbd images of the pool by rbd_qos_* option without prefix, config overrides like `rbd config pool set`, 0 is unlimited, unset options inherit the limit of the cluster, image ones take precedence", false),
+			"deletion_protection": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "the pool and all its data is only deleted on destroy when false",
+			},
 			"capacity": {
 				Type:     schema.TypeInt,
 				Optional: true,
@@ -58,7 +201,10 @@ func resourceCephPool() *schema.Resource {
 			},
 		},
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceCephPoolImport,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(10 * time.Minute),
 		},
 	}
 }
@@ -66,14 +212,16 @@ func resourceCephPool() *schema.Resource {
 func resourceCephPoolCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("create resource ceph_pool")
 	cluster := d.Get("cluster").(string)
-	client, err := getClient(cluster, meta)
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
 	poolName := strings.TrimSpace(d.Get("name").(string))
-	client.MutexKV.Lock(fmt.Sprintf("%s/%s", cluster, poolName))
-	defer client.MutexKV.Unlock(fmt.Sprintf("%s/%s", cluster, poolName))
+	if err = client.GetMutexKV().LockContext(ctx, fmt.Sprintf("%s/%s", cluster, poolName)); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(fmt.Sprintf("%s/%s", cluster, poolName))
 
 	ok, err := client.ExistPool(poolName)
 	if err != nil {
@@ -81,13 +229,43 @@ func resourceCephPoolCreate(ctx context.Context, d *schema.ResourceData, meta in
 	} else if !ok {
 		// create if not exists
 		log.Infof("create storage pool '%s/%s' ...", cluster, poolName)
-		if err = client.CreatePool(poolName); err != nil {
+		config := &sdk.PoolConfig{
+			PgNum:              d.Get("pg_num").(int),
+			PgpNum:             d.Get("pgp_num").(int),
+			CrushRule:          d.Get("crush_rule").(string),
+			PoolType:           d.Get("pool_type").(string),
+			ErasureCodeProfile: d.Get("erasure_code_profile").(string),
+		}
+		if err = client.CreatePool(poolName, config); err != nil {
 			return diag.FromErr(err)
 		}
 	} else {
 		log.Infof("storage pool '%s/%s' already exists", cluster, poolName)
 	}
 
+	if err = setCephPoolOptions(client, poolName, d); err != nil {
+		return diag.FromErr(err)
+	}
+	if err = setCephPoolQuota(client, poolName, d); err != nil {
+		return diag.FromErr(err)
+	}
+	if _, ok := d.GetOk("application"); ok {
+		if err = setCephPoolApplications(client, poolName, d); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	if d.Get("rbd_init").(bool) {
+		log.Infof("init rbd storage pool '%s/%s' ...", cluster, poolName)
+		if err = client.InitRBDPool(poolName); err != nil {
+			return diag.Errorf("init rbd storage pool '%s/%s' failed: %v", cluster, poolName, err)
+		}
+	}
+	if _, ok := d.GetOk("qos"); ok {
+		if err = setCephPoolQos(client, poolName, d); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
 	key := fmt.Sprintf("%s/%s", cluster, poolName)
 	d.SetId(key)
 
@@ -101,12 +279,24 @@ func resourceCephPoolCreate(ctx context.Context, d *schema.ResourceData, meta in
 	return resourceCephPoolRead(ctx, d, meta)
 }
 
+// resourceCephPoolImport imports pools by {cluster}/{pool}
+func resourceCephPoolImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	cluster, poolName, err := sdk.ParseCephPool(normalizeImportID(d.Id()))
+	if err != nil {
+		return nil, err
+	}
+	_ = d.Set("deletion_protection", true)
+	_ = d.Set("rbd_init", false)
+	return importByRead(ctx, d, meta, "storage pool", fmt.Sprintf("%s/%s", cluster, poolName), resourceCephPoolRead)
+}
+
 func resourceCephPoolRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("read resource ceph_pool")
-	tmp := strings.Split(d.Id(), "/")
-	cluster := tmp[0]
-	poolName := tmp[1]
-	client, err := getClient(cluster, meta)
+	cluster, poolName, err := sdk.ParseCephPool(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -125,6 +315,67 @@ func resourceCephPoolRead(ctx context.Context, d *schema.ResourceData, meta inte
 		return diag.FromErr(err)
 	}
 
+	opts, err := client.GetPoolOptions(poolName)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	for _, key := range cephPoolOptions {
+		value, ok := opts[key]
+		if !ok {
+			continue
+		}
+		switch d.Get(key).(type) {
+		case int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return diag.Errorf("storage pool '%s' invalid %s: %s", d.Id(), key, value)
+			}
+			_ = d.Set(key, n)
+		case float64:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return diag.Errorf("storage pool '%s' invalid %s: %s", d.Id(), key, value)
+			}
+			_ = d.Set(key, f)
+		case bool:
+			_ = d.Set(key, value == "true")
+		default:
+			_ = d.Set(key, value)
+		}
+	}
+	// only erasure pools have a profile
+	if profile, ok := opts["erasure_code_profile"]; ok {
+		_ = d.Set("pool_type", "erasure")
+		_ = d.Set("erasure_code_profile", profile)
+	} else {
+		_ = d.Set("pool_type", "replicated")
+		_ = d.Set("erasure_code_profile", "")
+		_ = d.Set("allow_ec_overwrites", false)
+	}
+
+	quota, err := client.GetPoolQuota(poolName)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	_ = d.Set("quota_max_bytes", quota.MaxBytes)
+	_ = d.Set("quota_max_objects", quota.MaxObjects)
+
+	apps, err := client.GetPoolApplications(poolName)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	_ = d.Set("application", apps)
+
+	metadata, err := client.ListPoolMetadata(poolName)
+	if err != nil {
+		return diag.Errorf("storage pool '%s' list metadata failed: %v", d.Id(), err)
+	}
+	qos, err := flattenQos(metadata)
+	if err != nil {
+		return diag.Errorf("storage pool '%s' %v", d.Id(), err)
+	}
+	_ = d.Set("qos", qos)
+
 	_ = d.Set("name", poolName)
 	_ = d.Set("cluster", cluster)
 	_ = d.Set("capacity", poolInfo.Capacity)
@@ -135,20 +386,209 @@ func resourceCephPoolRead(ctx context.Context, d *schema.ResourceData, meta inte
 	return nil
 }
 
+func resourceCephPoolUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("update resource ceph_pool")
+	cluster, poolName, err := sdk.ParseCephPool(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err = client.GetMutexKV().LockContext(ctx, d.Id()); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(d.Id())
+
+	d.Partial(true)
+	if err = setCephPoolOptions(client, poolName, d); err != nil {
+		return diag.FromErr(err)
+	}
+	if d.HasChanges("quota_max_bytes", "quota_max_objects") {
+		if err = setCephPoolQuota(client, poolName, d); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	if d.HasChange("application") {
+		if err = setCephPoolApplications(client, poolName, d); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	if d.HasChange("rbd_init") && d.Get("rbd_init").(bool) {
+		log.Infof("init rbd storage pool '%s' ...", d.Id())
+		if err = client.InitRBDPool(poolName); err != nil {
+			return diag.Errorf("init rbd storage pool '%s' failed: %v", d.Id(), err)
+		}
+	}
+	if d.HasChange("qos") {
+		if err = setCephPoolQos(client, poolName, d); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	d.Partial(false)
+
+	return resourceCephPoolRead(ctx, d, meta)
+}
+
+// cephPoolOptions are the `osd pool set` variables managed as attributes of
+// the same name, in the order they must be applied: size and pg_num first as
+// min_size and pgp_num can't exceed them
+var cephPoolOptions = []string{
+	"pg_autoscale_mode",
+	"crush_rule",
+	"size",
+	"min_size",
+	"pg_num",
+	"pgp_num",
+	"allow_ec_overwrites",
+	"compression_mode",
+	"compression_algorithm",
+	"compression_required_ratio",
+	"compression_min_blob_size",
+	"compression_max_blob_size",
+}
+
+// resourceCephPoolValidateType rejects erasure settings on replicated pools
+func resourceCephPoolValidateType(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Get("pool_type").(string) == "erasure" {
+		return nil
+	}
+	if tmp, ok := d.GetOk("erasure_code_profile"); ok && d.NewValueKnown("erasure_code_profile") && tmp.(string) != "" {
+		return fmt.Errorf("`erasure_code_profile` requires `pool_type` erasure")
+	}
+	if d.Get("allow_ec_overwrites").(bool) {
+		return fmt.Errorf("`allow_ec_overwrites` requires `pool_type` erasure")
+	}
+	return nil
+}
+
+// resourceCephPoolValidateRBDInit requires the rbd application along with
+// rbd_init, which enables it
+func resourceCephPoolValidateRBDInit(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if !d.Get("rbd_init").(bool) || !d.NewValueKnown("application") {
+		return nil
+	}
+	if !d.Get("application").(*schema.Set).Contains("rbd") {
+		return fmt.Errorf("`rbd_init` requires rbd in `application`")
+	}
+	return nil
+}
+
+// setCephPoolApplications enables the configured applications and disables
+// the others
+func setCephPoolApplications(client sdk.CephClientI, poolName string, d *schema.ResourceData) error {
+	apps := d.Get("application").(*schema.Set)
+	current, err := client.GetPoolApplications(poolName)
+	if err != nil {
+		return err
+	}
+	enabled := make(map[string]bool, len(current))
+	for _, app := range current {
+		enabled[app] = true
+	}
+	for _, app := range expandStringSet(apps) {
+		if enabled[app] {
+			continue
+		}
+		log.Infof("enable application %s on storage pool '%s'", app, poolName)
+		if err = client.EnablePoolApplication(poolName, app); err != nil {
+			return fmt.Errorf("enable application %s on storage pool '%s' failed: %v", app, poolName, err)
+		}
+	}
+	for _, app := range current {
+		if apps.Contains(app) {
+			continue
+		}
+		log.Infof("disable application %s on storage pool '%s'", app, poolName)
+		if err = client.DisablePoolApplication(poolName, app); err != nil {
+			return fmt.Errorf("disable application %s on storage pool '%s' failed: %v", app, poolName, err)
+		}
+	}
+	return nil
+}
+
+// setCephPoolOptions applies the configured pool variables which differ
+// from the current ones, explicit zeros included
+func setCephPoolOptions(client sdk.CephClientI, poolName string, d *schema.ResourceData) error {
+	opts, err := client.GetPoolOptions(poolName)
+	if err != nil {
+		return err
+	}
+	for _, key := range cephPoolOptions {
+		tmp, ok := d.Get(key), d.HasChange(key)
+		if d.IsNewResource() {
+			tmp, ok = d.GetOkExists(key)
+		}
+		if !ok {
+			continue
+		}
+		value := fmt.Sprint(tmp)
+		if opts[key] == value {
+			continue
+		}
+		log.Infof("set storage pool '%s' %s: %s => %s", poolName, key, opts[key], value)
+		if err = client.SetPoolOption(poolName, key, value); err != nil {
+			return fmt.Errorf("set %s of storage pool '%s' failed: %v", key, poolName, err)
+		}
+	}
+	return nil
+}
+
+// setCephPoolQuota applies the configured quota if it differs from the
+// current one
+func setCephPoolQuota(client sdk.CephClientI, poolName string, d *schema.ResourceData) error {
+	quota := &sdk.PoolQuota{
+		MaxBytes:   uint64(d.Get("quota_max_bytes").(int)),
+		MaxObjects: uint64(d.Get("quota_max_objects").(int)),
+	}
+	current, err := client.GetPoolQuota(poolName)
+	if err != nil {
+		return err
+	} else if *current == *quota {
+		return nil
+	}
+	log.Infof("set quota of storage pool '%s': max_bytes %d, max_objects %d", poolName, quota.MaxBytes, quota.MaxObjects)
+	if err = client.SetPoolQuota(poolName, quota); err != nil {
+		return fmt.Errorf("set quota of storage pool '%s' failed: %v", poolName, err)
+	}
+	return nil
+}
+
+// setCephPoolQos applies the config overrides of the qos map
+func setCephPoolQos(client sdk.CephClientI, poolName string, d *schema.ResourceData) error {
+	current, err := client.ListPoolMetadata(poolName)
+	if err != nil {
+		return fmt.Errorf("list metadata of storage pool '%s' failed: %v", poolName, err)
+	}
+	return updateQos(current, expandQos(d), fmt.Sprintf("storage pool '%s'", poolName),
+		func(key, value string) error { return client.SetPoolMetadata(poolName, key, value) },
+		func(key string) error { return client.RemovePoolMetadata(poolName, key) })
+}
+
 func resourceCephPoolDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("delete resource ceph_pool")
-	cluster := strings.Split(d.Id(), "/")[0]
-	client, err := getClient(cluster, meta)
+	cluster, poolName, err := sdk.ParseCephPool(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	client.MutexKV.Lock(d.Id())
-	defer client.MutexKV.Unlock(d.Id())
+	if err = client.GetMutexKV().LockContext(ctx, d.Id()); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(d.Id())
+
+	if d.Get("deletion_protection").(bool) {
+		return diag.Errorf("storage pool '%s' can't be deleted while `deletion_protection` is set", d.Id())
+	}
 
 	log.Infof("delete storage pool '%s' ...", d.Id())
-	// return client.deletePool(d.Id())
-	return nil
+	return diag.FromErr(client.DeletePool(poolName))
 }
 
 //// Deprecated
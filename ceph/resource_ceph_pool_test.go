@@ -0,0 +1,415 @@
+package ceph
+
+import (
+	"strings"
+	"testing"
+
+	"terraform-provider-ceph/ceph/sdk"
+)
+
+func TestCephPool_Basic(t *testing.T) {
+	meta := testMeta("ceph")
+	r := resourceCephPool()
+	config := map[string]interface{}{"name": "pool1", "deletion_protection": false}
+
+	state := testMustApply(t, r, nil, config, meta)
+	if state.ID != "ceph/pool1" {
+		t.Fatalf("expect id ceph/pool1, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "cluster", "ceph")
+	testCheckAttr(t, state, "name", "pool1")
+	testCheckAttr(t, state, "state", "HEALTH_OK")
+	testCheckAttr(t, state, "size", "3")
+	testCheckAttr(t, state, "crush_rule", "replicated_rule")
+	client := testFakeClient(t, meta, "ceph")
+	if ok, _ := client.ExistPool("pool1"); !ok {
+		t.Fatal("pool1 not created")
+	}
+
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := client.ExistPool("pool1"); ok {
+		t.Fatal("pool1 not deleted")
+	}
+}
+
+func TestCephPool_Settings(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	client.CrushRules = append(client.CrushRules, "ssd")
+	r := resourceCephPool()
+	config := map[string]interface{}{
+		"name":              "pool1",
+		"size":              2,
+		"min_size":          1,
+		"pg_num":            64,
+		"pg_autoscale_mode": "off",
+		"crush_rule":        "ssd",
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "size", "2")
+	testCheckAttr(t, state, "min_size", "1")
+	testCheckAttr(t, state, "pg_num", "64")
+	testCheckAttr(t, state, "pgp_num", "64")
+	testCheckAttr(t, state, "pg_autoscale_mode", "off")
+	testCheckAttr(t, state, "crush_rule", "ssd")
+
+	config["size"] = 4
+	config["min_size"] = 3
+	config["pg_num"] = 128
+	config["pgp_num"] = 128
+	state = testMustApply(t, r, state, config, meta)
+	if state.ID != "ceph/pool1" {
+		t.Fatalf("expect pool updated in place, got %s", state.ID)
+	}
+	opts, _ := client.GetPoolOptions("pool1")
+	for key, value := range map[string]string{"size": "4", "min_size": "3", "pg_num": "128", "pgp_num": "128"} {
+		if opts[key] != value {
+			t.Fatalf("expect %s = %s, got %s", key, value, opts[key])
+		}
+		testCheckAttr(t, state, key, value)
+	}
+
+	// drift made outside terraform is reverted
+	_ = client.SetPoolOption("pool1", "size", "2")
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "size", "2")
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "size", "4")
+}
+
+func TestCephPool_Compression(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	r := resourceCephPool()
+	config := map[string]interface{}{
+		"name":                       "pool1",
+		"compression_mode":           "aggressive",
+		"compression_algorithm":      "zstd",
+		"compression_required_ratio": 0.875,
+		"compression_min_blob_size":  8192,
+		"compression_max_blob_size":  65536,
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "compression_mode", "aggressive")
+	testCheckAttr(t, state, "compression_required_ratio", "0.875")
+	testCheckAttr(t, state, "compression_max_blob_size", "65536")
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	config["compression_mode"] = "passive"
+	config["compression_algorithm"] = "lz4"
+	config["compression_required_ratio"] = 0.5
+	state = testMustApply(t, r, state, config, meta)
+	if state.ID != "ceph/pool1" {
+		t.Fatalf("expect pool updated in place, got %s", state.ID)
+	}
+	opts, _ := client.GetPoolOptions("pool1")
+	for key, value := range map[string]string{"compression_mode": "passive", "compression_algorithm": "lz4", "compression_required_ratio": "0.5"} {
+		if opts[key] != value {
+			t.Fatalf("expect %s = %s, got %s", key, value, opts[key])
+		}
+		testCheckAttr(t, state, key, value)
+	}
+
+	// explicit zeros are set too
+	config["compression_min_blob_size"] = 0
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "compression_min_blob_size", "0")
+	if opts, _ = client.GetPoolOptions("pool1"); opts["compression_min_blob_size"] != "0" {
+		t.Fatalf("expect compression_min_blob_size = 0, got %s", opts["compression_min_blob_size"])
+	}
+	_ = client.CreatePool("pool2", nil)
+	_ = client.SetPoolOption("pool2", "compression_max_blob_size", "65536")
+	state2 := testMustApply(t, r, nil, map[string]interface{}{
+		"name":                      "pool2",
+		"compression_max_blob_size": 0,
+	}, meta)
+	testCheckAttr(t, state2, "compression_max_blob_size", "0")
+
+	config["compression_algorithm"] = "gzip"
+	if _, err := testApply(r, state, config, meta); err == nil {
+		t.Fatal("expect error with unknown compression algorithm")
+	}
+}
+
+func TestCephPool_Quota(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	r := resourceCephPool()
+	config := map[string]interface{}{
+		"name":              "tenant1",
+		"quota_max_bytes":   10 << 30,
+		"quota_max_objects": 100000,
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "quota_max_bytes", "10737418240")
+	testCheckAttr(t, state, "quota_max_objects", "100000")
+	if quota, _ := client.GetPoolQuota("tenant1"); quota.MaxBytes != 10<<30 || quota.MaxObjects != 100000 {
+		t.Fatalf("unexpected quota %#v", quota)
+	}
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	// quota changed outside terraform is reverted
+	_ = client.SetPoolQuota("tenant1", &sdk.PoolQuota{})
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "quota_max_bytes", "0")
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "quota_max_bytes", "10737418240")
+
+	// removing the attributes removes the quota
+	delete(config, "quota_max_bytes")
+	delete(config, "quota_max_objects")
+	state = testMustApply(t, r, state, config, meta)
+	if quota, _ := client.GetPoolQuota("tenant1"); quota.MaxBytes != 0 || quota.MaxObjects != 0 {
+		t.Fatalf("expect quota removed, got %#v", quota)
+	}
+}
+
+func TestCephPool_Qos(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	r := resourceCephPool()
+	config := map[string]interface{}{
+		"name":                "pool1",
+		"deletion_protection": false,
+		"qos": map[string]interface{}{
+			"iops_limit":      1000,
+			"write_bps_limit": 104857600,
+			"read_bps_limit":  0,
+		},
+	}
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "qos.%", "3")
+	testCheckAttr(t, state, "qos.iops_limit", "1000")
+	testCheckAttr(t, state, "qos.read_bps_limit", "0")
+	metadata, _ := client.ListPoolMetadata("pool1")
+	if len(metadata) != 3 || metadata["conf_rbd_qos_iops_limit"] != "1000" || metadata["conf_rbd_qos_write_bps_limit"] != "104857600" ||
+		metadata["conf_rbd_qos_read_bps_limit"] != "0" {
+		t.Fatalf("expect qos config overrides of the pool, got %v", metadata)
+	}
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	data, err := testReadData(dataSourceCephPool(), map[string]interface{}{"name": "pool1"}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, data, "qos.write_bps_limit", "104857600")
+
+	if _, err := testApply(r, state, map[string]interface{}{
+		"name":                "pool1",
+		"deletion_protection": false,
+		"qos":                 map[string]interface{}{"iops": 1000},
+	}, meta); err == nil || !strings.Contains(err.Error(), "iops_limit") {
+		t.Fatalf("expect unknown qos options to be refused, got %v", err)
+	}
+
+	// other config overrides are left alone
+	_ = client.SetPoolMetadata("pool1", "conf_rbd_qos_iops_limit", "5000")
+	_ = client.SetPoolMetadata("pool1", "conf_rbd_cache", "false")
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "qos.iops_limit", "5000")
+	delete(config, "qos")
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "qos.%", "0")
+	metadata, _ = client.ListPoolMetadata("pool1")
+	if len(metadata) != 1 || metadata["conf_rbd_cache"] != "false" {
+		t.Fatalf("expect qos config overrides removed, got %v", metadata)
+	}
+}
+
+func TestCephPool_Application(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	r := resourceCephPool()
+	config := map[string]interface{}{
+		"name":        "pool1",
+		"application": []interface{}{"rbd"},
+		"rbd_init":    true,
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "application.#", "1")
+	if apps, _ := client.GetPoolApplications("pool1"); len(apps) != 1 || apps[0] != "rbd" {
+		t.Fatalf("expect rbd enabled, got %v", apps)
+	}
+	if !client.IsRBDPoolInitialized("pool1") {
+		t.Fatal("expect pool initialized for rbd")
+	}
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	config["application"] = []interface{}{"rbd", "custom"}
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "application.#", "2")
+
+	// applications enabled outside terraform are disabled
+	_ = client.EnablePoolApplication("pool1", "rgw")
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "application.#", "3")
+	state = testMustApply(t, r, state, config, meta)
+	if apps, _ := client.GetPoolApplications("pool1"); len(apps) != 2 || apps[0] != "custom" || apps[1] != "rbd" {
+		t.Fatalf("expect custom and rbd enabled, got %v", apps)
+	}
+
+	config["application"] = []interface{}{"rgw"}
+	if _, err := testApply(r, state, config, meta); err == nil {
+		t.Fatal("expect error with rbd_init but no rbd application")
+	}
+}
+
+func TestCephPool_ApplicationUnmanaged(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_ = client.EnablePoolApplication("pool1", "cephfs")
+	r := resourceCephPool()
+	config := map[string]interface{}{"name": "pool1"}
+
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "application.#", "1")
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect applications not managed without the attribute, got %#v", diff)
+	}
+
+	config["rbd_init"] = true
+	config["application"] = []interface{}{"rbd"}
+	state = testMustApply(t, r, state, config, meta)
+	if !client.IsRBDPoolInitialized("pool1") {
+		t.Fatal("expect pool initialized for rbd on update")
+	}
+	if apps, _ := client.GetPoolApplications("pool1"); len(apps) != 1 || apps[0] != "rbd" {
+		t.Fatalf("expect only rbd enabled, got %v", apps)
+	}
+}
+
+func TestCephPool_DeletionProtection(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	r := resourceCephPool()
+	config := map[string]interface{}{"name": "pool1"}
+
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "deletion_protection", "true")
+	if err := testDestroy(r, state, meta); err == nil {
+		t.Fatal("expect destroy to fail with deletion_protection")
+	}
+	if ok, _ := client.ExistPool("pool1"); !ok {
+		t.Fatal("protected pool1 deleted")
+	}
+
+	config["deletion_protection"] = false
+	state = testMustApply(t, r, state, config, meta)
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := client.ExistPool("pool1"); ok {
+		t.Fatal("pool1 not deleted")
+	}
+}
+
+func TestCephPool_DeletedOutside(t *testing.T) {
+	meta := testMeta("ceph")
+	r := resourceCephPool()
+
+	state := testMustApply(t, r, nil, map[string]interface{}{"name": "pool1"}, meta)
+	_ = testFakeClient(t, meta, "ceph").DeletePool("pool1")
+
+	if state = testRefresh(t, r, state, meta); state != nil {
+		t.Fatalf("expect pool removed from state, got %s", state.ID)
+	}
+}
+
+func TestCephPool_UnknownCluster(t *testing.T) {
+	meta := testMeta("ceph")
+	r := resourceCephPool()
+
+	if _, err := testApply(r, nil, map[string]interface{}{"name": "pool1", "cluster": "dr"}, meta); err == nil {
+		t.Fatal("expect error for unconfigured cluster")
+	}
+}
+
+func TestCephPool_Erasure(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.SetErasureCodeProfile("ec21", map[string]string{"k": "2", "m": "1"})
+	r := resourceCephPool()
+	config := map[string]interface{}{
+		"name":                 "ecpool",
+		"pool_type":            "erasure",
+		"erasure_code_profile": "ec21",
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "pool_type", "erasure")
+	testCheckAttr(t, state, "erasure_code_profile", "ec21")
+	testCheckAttr(t, state, "size", "3")
+	testCheckAttr(t, state, "allow_ec_overwrites", "false")
+
+	config["allow_ec_overwrites"] = true
+	state = testMustApply(t, r, state, config, meta)
+	if state.ID != "ceph/ecpool" {
+		t.Fatalf("expect pool updated in place, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "allow_ec_overwrites", "true")
+
+	config["allow_ec_overwrites"] = false
+	if _, err := testApply(r, state, config, meta); err == nil {
+		t.Fatal("expect error disabling allow_ec_overwrites")
+	}
+}
+
+func TestCephPool_ErasureSettingsOnReplicated(t *testing.T) {
+	meta := testMeta("ceph")
+
+	_, err := testApply(resourceCephPool(), nil, map[string]interface{}{
+		"name":                "pool1",
+		"allow_ec_overwrites": true,
+	}, meta)
+	if err == nil {
+		t.Fatal("expect error enabling allow_ec_overwrites on a replicated pool")
+	}
+}
+
+func TestCephPool_Import(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_ = client.SetPoolQuota("pool1", &sdk.PoolQuota{MaxObjects: 1000})
+	r := resourceCephPool()
+
+	state, err := testImport(r, " ceph/pool1/ ", meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.ID != "ceph/pool1" {
+		t.Fatalf("expect id ceph/pool1, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "name", "pool1")
+	testCheckAttr(t, state, "size", "3")
+	testCheckAttr(t, state, "quota_max_objects", "1000")
+	testCheckAttr(t, state, "deletion_protection", "true")
+	if diff := testPlan(t, r, state, map[string]interface{}{"name": "pool1", "quota_max_objects": 1000}, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after import, got %#v", diff)
+	}
+
+	for _, id := range []string{"pool1", "ceph/", "/pool1", "ceph/pool1/vol1", "ceph/pool2", "dr/pool1"} {
+		if _, err = testImport(r, id, meta); err == nil {
+			t.Fatalf("expect error importing '%s'", id)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package ceph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	log "github.com/sirupsen/logrus"
+)
+
+func resourceCephRBDMirrorPool() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceCephRBDMirrorPoolCreate,
+		ReadContext:   resourceCephRBDMirrorPoolRead,
+		UpdateContext: resourceCephRBDMirrorPoolUpdate,
+		DeleteContext: resourceCephRBDMirrorPoolDelete,
+		CustomizeDiff: resourceCephRBDMirrorPoolValidatePeer,
+		Schema: map[string]*schema.Schema{
+			"pool_id": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				Description:  "$cluster_name/$pool_name",
+				ValidateFunc: validation.NoZeroValues,
+			},
+			"mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      sdk.MirrorModeImage,
+				Description:  "none, pool mirrors all images with journaling, image mirrors the volumes with mirroring enabled",
+				ValidateFunc: validation.StringInSlice([]string{sdk.MirrorModeNone, sdk.MirrorModePool, sdk.MirrorModeImage}, false),
+			},
+			"site_name": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "mirror site name of the cluster, shared by all its pools, the fsid unless set with `rbd mirror pool peer bootstrap create --site-name`",
+			},
+			"bootstrap_token": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "token of this site, which the peer site imports, it's created once and kept in the state",
+			},
+			"peer_bootstrap_token": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "bootstrap token of the peer site to import, removing it doesn't remove the peer",
+			},
+			"peer_direction": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      sdk.MirrorPeerRxTx,
+				Description:  "rx-only or rx-tx, the direction of the imported peer",
+				ValidateFunc: validation.StringInSlice([]string{sdk.MirrorPeerRxOnly, sdk.MirrorPeerRxTx}, false),
+			},
+			"peers": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"uuid": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"site_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"client_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"direction": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceCephRBDMirrorPoolImport,
+		},
+	}
+}
+
+func resourceCephRBDMirrorPoolCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("create resource ceph_rbd_mirror_pool")
+	cluster, poolName, err := sdk.ParseCephPool(d.Get("pool_id").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	key := fmt.Sprintf("%s/%s", cluster, poolName)
+	if err = client.GetMutexKV().LockContext(ctx, key); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(key)
+
+	if ok, err := client.ExistPool(poolName); err != nil {
+		return diag.FromErr(err)
+	} else if !ok {
+		return diag.Errorf("storage pool '%s' not found", key)
+	}
+
+	mode := d.Get("mode").(string)
+	log.Infof("set mirror mode of storage pool '%s': %s", key, mode)
+	if err = client.SetMirrorMode(poolName, mode); err != nil {
+		return diag.Errorf("set mirror mode of storage pool '%s' failed: %v", key, err)
+	}
+
+	d.SetId(key)
+	if err = importMirrorPeer(client, key, poolName, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	log.Infof("RBD mirror pool ID: %s", d.Id())
+	return resourceCephRBDMirrorPoolRead(ctx, d, meta)
+}
+
+// importMirrorPeer imports peer_bootstrap_token if it's set
+func importMirrorPeer(client sdk.CephClientI, key, poolName string, d *schema.ResourceData) error {
+	token := d.Get("peer_bootstrap_token").(string)
+	if token == "" {
+		return nil
+	}
+	direction := d.Get("peer_direction").(string)
+	log.Infof("import %s mirror peer of storage pool '%s' ...", direction, key)
+	if err := client.ImportMirrorPeerBootstrap(poolName, direction, token); err != nil {
+		return fmt.Errorf("import mirror peer of storage pool '%s' failed: %v", key, err)
+	}
+	return nil
+}
+
+// resourceCephRBDMirrorPoolImport imports the mirroring of pools by
+// {cluster}/{pool}, the bootstrap token is created by the read
+func resourceCephRBDMirrorPoolImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	cluster, poolName, err := sdk.ParseCephPool(normalizeImportID(d.Id()))
+	if err != nil {
+		return nil, err
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := client.ExistPool(poolName); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("storage pool '%s/%s' not found", cluster, poolName)
+	}
+	_ = d.Set("peer_direction", sdk.MirrorPeerRxTx)
+	return importByRead(ctx, d, meta, "rbd mirror pool", fmt.Sprintf("%s/%s", cluster, poolName), resourceCephRBDMirrorPoolRead)
+}
+
+func resourceCephRBDMirrorPoolRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("read resource ceph_rbd_mirror_pool")
+	cluster, poolName, err := sdk.ParseCephPool(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if ok, err := client.ExistPool(poolName); err != nil {
+		return diag.FromErr(err)
+	} else if !ok {
+		log.Warnf("storage pool of rbd mirror pool '%s' may have been deleted outside Terraform", d.Id())
+		d.SetId("")
+		return nil
+	}
+
+	mode, err := client.GetMirrorMode(poolName)
+	if err != nil {
+		return diag.Errorf("get mirror mode of storage pool '%s' failed: %v", d.Id(), err)
+	}
+	siteName, err := client.GetMirrorSiteName(poolName)
+	if err != nil {
+		return diag.Errorf("get mirror site name of cluster %s failed: %v", cluster, err)
+	}
+	peers, err := client.ListMirrorPeers(poolName)
+	if err != nil {
+		return diag.Errorf("list mirror peers of storage pool '%s' failed: %v", d.Id(), err)
+	}
+	// the token of the state is kept, so that peers importing it don't see
+	// a change whenever the pool is created or imported again
+	if d.Get("bootstrap_token").(string) == "" {
+		token, err := client.CreateMirrorPeerBootstrap(poolName)
+		if err != nil {
+			return diag.Errorf("create mirror bootstrap token of storage pool '%s' failed: %v", d.Id(), err)
+		}
+		_ = d.Set("bootstrap_token", token)
+	}
+	peerList := make([]interface{}, 0, len(peers))
+	for _, peer := range peers {
+		peerList = append(peerList, map[string]interface{}{
+			"uuid":        peer.UUID,
+			"site_name":   peer.SiteName,
+			"client_name": peer.ClientName,
+			"direction":   peer.Direction,
+		})
+	}
+
+	_ = d.Set("pool_id", fmt.Sprintf("%s/%s", cluster, poolName))
+	_ = d.Set("mode", mode)
+	_ = d.Set("site_name", siteName)
+	_ = d.Set("peers", peerList)
+	return nil
+}
+
+func resourceCephRBDMirrorPoolUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("update resource ceph_rbd_mirror_pool")
+	cluster, poolName, err := sdk.ParseCephPool(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err = client.GetMutexKV().LockContext(ctx, d.Id()); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(d.Id())
+
+	// the peers are removed with mirroring, the token is imported again when
+	// it's enabled
+	o, n := d.GetChange("mode")
+	if d.HasChange("mode") && n.(string) == sdk.MirrorModeNone {
+		if err = disableMirroring(client, cluster, poolName); err != nil {
+			return diag.FromErr(err)
+		}
+	} else if d.HasChange("mode") {
+		log.Infof("set mirror mode of storage pool '%s': %s", d.Id(), n)
+		if err = client.SetMirrorMode(poolName, n.(string)); err != nil {
+			return diag.Errorf("set mirror mode of storage pool '%s' failed: %v", d.Id(), err)
+		}
+	}
+	if d.HasChanges("peer_bootstrap_token", "peer_direction") || o.(string) == sdk.MirrorModeNone && n.(string) != sdk.MirrorModeNone {
+		if err = importMirrorPeer(client, d.Id(), poolName, d); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	return resourceCephRBDMirrorPoolRead(ctx, d, meta)
+}
+
+// resourceCephRBDMirrorPoolDelete removes the peers and disables mirroring,
+// it fails while volumes of the pool are mirrored
+func resourceCephRBDMirrorPoolDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("delete resource ceph_rbd_mirror_pool")
+	cluster, poolName, err := sdk.ParseCephPool(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err = client.GetMutexKV().LockContext(ctx, d.Id()); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(d.Id())
+
+	if ok, err := client.ExistPool(poolName); err != nil {
+		return diag.FromErr(err)
+	} else if !ok {
+		return nil
+	}
+	if err = disableMirroring(client, cluster, poolName); err != nil {
+		return diag.FromErr(err)
+	}
+	return nil
+}
+
+// disableMirroring removes the peers of the pool and disables mirroring,
+// librbd refuses to disable it while peers are registered. Mirrored volumes
+// are looked for first so that the peers are kept if disabling would fail,
+// in pool mode librbd disables the mirroring of the volumes itself.
+func disableMirroring(client sdk.CephClientI, cluster, poolName string) error {
+	key := fmt.Sprintf("%s/%s", cluster, poolName)
+	mode, err := client.GetMirrorMode(poolName)
+	if err != nil {
+		return fmt.Errorf("get mirror mode of storage pool '%s' failed: %v", key, err)
+	}
+	if mode == sdk.MirrorModeImage {
+		volumes, err := listMirroredVolumes(client, cluster, poolName)
+		if err != nil {
+			return fmt.Errorf("list mirrored volumes of storage pool '%s' failed: %v", key, err)
+		} else if len(volumes) > 0 {
+			return fmt.Errorf("disable mirroring of storage pool '%s' failed, disable mirroring of its volumes first: %s",
+				key, strings.Join(volumes, ", "))
+		}
+	}
+	if err = removeMirrorPeers(client, key, poolName); err != nil {
+		return err
+	}
+	log.Infof("disable mirroring of storage pool '%s' ...", key)
+	if err = client.SetMirrorMode(poolName, sdk.MirrorModeNone); err != nil {
+		return fmt.Errorf("disable mirroring of storage pool '%s' failed: %v", key, err)
+	}
+	return nil
+}
+
+// listMirroredVolumes returns the ids of the volumes of all namespaces of the
+// pool with mirroring enabled
+func listMirroredVolumes(client sdk.CephClientI, cluster, poolName string) ([]string, error) {
+	namespaces, err := client.ListRBDNamespaces(poolName)
+	if err != nil {
+		return nil, err
+	}
+	var volumes []string
+	for _, namespace := range append([]string{""}, namespaces...) {
+		names, err := client.ListVols(poolName, namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			volume, err := client.LookupVolByName(poolName, namespace, name)
+			if err != nil {
+				return nil, err
+			} else if volume == nil {
+				continue
+			}
+			info, err := volume.GetMirrorInfo()
+			volume.Close()
+			if err != nil {
+				return nil, err
+			} else if info.Enabled() {
+				volumes = append(volumes, sdk.FormatCephVol(cluster, poolName, namespace, name))
+			}
+		}
+	}
+	return volumes, nil
+}
+
+// removeMirrorPeers removes all peer sites of the pool
+func removeMirrorPeers(client sdk.CephClientI, key, poolName string) error {
+	peers, err := client.ListMirrorPeers(poolName)
+	if err != nil {
+		return fmt.Errorf("list mirror peers of storage pool '%s' failed: %v", key, err)
+	}
+	for _, peer := range peers {
+		log.Infof("remove mirror peer %s (%s) of storage pool '%s'", peer.SiteName, peer.UUID, key)
+		if err = client.RemoveMirrorPeer(poolName, peer.UUID); err != nil {
+			return fmt.Errorf("remove mirror peer %s of storage pool '%s' failed: %v", peer.SiteName, key, err)
+		}
+	}
+	return nil
+}
+
+// resourceCephRBDMirrorPoolValidatePeer refuses peers of pools which aren't
+// mirrored
+func resourceCephRBDMirrorPoolValidatePeer(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if token, _ := d.Get("peer_bootstrap_token").(string); token != "" && d.Get("mode").(string) == sdk.MirrorModeNone {
+		return fmt.Errorf("`peer_bootstrap_token` requires `mode` pool or image")
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package ceph
+
+import (
+	"strings"
+	"testing"
+
+	"terraform-provider-ceph/ceph/sdk"
+)
+
+func TestCephRBDMirrorPool_Basic(t *testing.T) {
+	meta := testMeta("site-a", "site-b")
+	clientA := testFakeClient(t, meta, "site-a")
+	clientB := testFakeClient(t, meta, "site-b")
+	_ = clientA.CreatePool("vms", nil)
+	_ = clientB.CreatePool("vms", nil)
+	r := resourceCephRBDMirrorPool()
+
+	stateA := testMustApply(t, r, nil, map[string]interface{}{"pool_id": "site-a/vms"}, meta)
+	if stateA.ID != "site-a/vms" {
+		t.Fatalf("expect id site-a/vms, got %s", stateA.ID)
+	}
+	testCheckAttr(t, stateA, "mode", "image")
+	siteName, _ := clientA.GetMirrorSiteName("vms")
+	testCheckAttr(t, stateA, "site_name", siteName)
+	testCheckAttr(t, stateA, "peers.#", "0")
+	token := stateA.Attributes["bootstrap_token"]
+	if token == "" {
+		t.Fatal("expect a bootstrap token")
+	}
+
+	// a new token would differ since the mons are part of it
+	clientA.Mons = []string{"127.0.0.2:6789"}
+	if stateA = testRefresh(t, r, stateA, meta); stateA.Attributes["bootstrap_token"] != token {
+		t.Fatal("expect the bootstrap token of the state to be kept")
+	}
+
+	configB := map[string]interface{}{
+		"pool_id":              "site-b/vms",
+		"mode":                 "pool",
+		"peer_bootstrap_token": token,
+		"peer_direction":       "rx-only",
+	}
+	stateB := testMustApply(t, r, nil, configB, meta)
+	testCheckAttr(t, stateB, "mode", "pool")
+	testCheckAttr(t, stateB, "peers.#", "1")
+	testCheckAttr(t, stateB, "peers.0.direction", "rx-only")
+	testCheckAttr(t, stateB, "peers.0.client_name", "client.rbd-mirror-peer")
+	if diff := testPlan(t, r, stateB, configB, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	configB["mode"] = "none"
+	if _, err := testApply(r, stateB, configB, meta); err == nil || !strings.Contains(err.Error(), "peer_bootstrap_token") {
+		t.Fatalf("expect a peer to require mirroring, got %v", err)
+	}
+
+	if err := testDestroy(r, stateB, meta); err != nil {
+		t.Fatal(err)
+	}
+	if peers, _ := clientB.ListMirrorPeers("vms"); len(peers) != 0 {
+		t.Fatalf("expect peers removed, got %v", peers)
+	}
+	if mode, _ := clientB.GetMirrorMode("vms"); mode != sdk.MirrorModeNone {
+		t.Fatalf("expect mirroring disabled, got %s", mode)
+	}
+}
+
+func TestCephRBDMirrorPool_MirroredVolumes(t *testing.T) {
+	meta := testMeta("site-a", "site-b")
+	_ = testFakeClient(t, meta, "site-a").CreatePool("vms", nil)
+	client := testFakeClient(t, meta, "site-b")
+	_ = client.CreatePool("vms", nil)
+	r := resourceCephRBDMirrorPool()
+	stateA := testMustApply(t, r, nil, map[string]interface{}{"pool_id": "site-a/vms"}, meta)
+	state := testMustApply(t, r, nil, map[string]interface{}{
+		"pool_id":              "site-b/vms",
+		"peer_bootstrap_token": stateA.Attributes["bootstrap_token"],
+	}, meta)
+
+	// the peer is kept when mirroring can't be disabled
+	vol, _ := client.CreateVol("vms", "", "vol1", 1024, nil)
+	_ = vol.EnableMirroring(sdk.MirrorImageModeSnapshot)
+	if err := testDestroy(r, state, meta); err == nil || !strings.Contains(err.Error(), "disable mirroring of its volumes first") {
+		t.Fatalf("expect destroy to fail while volumes are mirrored, got %v", err)
+	}
+	if peers, _ := client.ListMirrorPeers("vms"); len(peers) != 1 {
+		t.Fatalf("expect peer kept, got %v", peers)
+	}
+	_ = vol.DisableMirroring(false)
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	if peers, _ := client.ListMirrorPeers("vms"); len(peers) != 0 {
+		t.Fatalf("expect peers removed, got %v", peers)
+	}
+}
+
+func TestCephRBDMirrorPool_Disable(t *testing.T) {
+	meta := testMeta("site-a", "site-b")
+	_ = testFakeClient(t, meta, "site-a").CreatePool("vms", nil)
+	client := testFakeClient(t, meta, "site-b")
+	_ = client.CreatePool("vms", nil)
+	r := resourceCephRBDMirrorPool()
+	stateA := testMustApply(t, r, nil, map[string]interface{}{"pool_id": "site-a/vms"}, meta)
+	config := map[string]interface{}{
+		"pool_id":              "site-b/vms",
+		"peer_bootstrap_token": stateA.Attributes["bootstrap_token"],
+	}
+	state := testMustApply(t, r, nil, config, meta)
+
+	// librbd refuses to disable mirroring while peers are registered
+	if err := client.SetMirrorMode("vms", sdk.MirrorModeNone); err == nil {
+		t.Fatal("expect disabling mirroring to fail while peers are registered")
+	}
+
+	// the peer is removed before mirroring is disabled
+	config = map[string]interface{}{
+		"pool_id": "site-b/vms",
+		"mode":    "none",
+	}
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "mode", "none")
+	testCheckAttr(t, state, "peers.#", "0")
+	if mode, _ := client.GetMirrorMode("vms"); mode != sdk.MirrorModeNone {
+		t.Fatalf("expect mirroring disabled, got %s", mode)
+	}
+
+	// mirrored volumes of namespaces keep the peer too
+	config = map[string]interface{}{
+		"pool_id":              "site-b/vms",
+		"peer_bootstrap_token": stateA.Attributes["bootstrap_token"],
+	}
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "peers.#", "1")
+	_ = client.CreateRBDNamespace("vms", "ns1")
+	vol, _ := client.CreateVol("vms", "ns1", "vol1", 1024, nil)
+	_ = vol.EnableMirroring(sdk.MirrorImageModeSnapshot)
+	config["mode"] = "none"
+	delete(config, "peer_bootstrap_token")
+	if _, err := testApply(r, state, config, meta); err == nil || !strings.Contains(err.Error(), "site-b/vms/ns1/vol1") {
+		t.Fatalf("expect disabling to fail while site-b/vms/ns1/vol1 is mirrored, got %v", err)
+	}
+	if peers, _ := client.ListMirrorPeers("vms"); len(peers) != 1 {
+		t.Fatalf("expect peer kept, got %v", peers)
+	}
+}
+
+func TestCephRBDMirrorPool_Reenable(t *testing.T) {
+	meta := testMeta("site-a", "site-b")
+	_ = testFakeClient(t, meta, "site-a").CreatePool("vms", nil)
+	client := testFakeClient(t, meta, "site-b")
+	_ = client.CreatePool("vms", nil)
+	r := resourceCephRBDMirrorPool()
+	stateA := testMustApply(t, r, nil, map[string]interface{}{"pool_id": "site-a/vms"}, meta)
+	config := map[string]interface{}{
+		"pool_id":              "site-b/vms",
+		"peer_bootstrap_token": stateA.Attributes["bootstrap_token"],
+	}
+	state := testMustApply(t, r, nil, config, meta)
+
+	// mirroring disabled outside terraform is enabled again with the peer
+	peers, _ := client.ListMirrorPeers("vms")
+	_ = client.RemoveMirrorPeer("vms", peers[0].UUID)
+	_ = client.SetMirrorMode("vms", sdk.MirrorModeNone)
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "mode", "none")
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "mode", "image")
+	testCheckAttr(t, state, "peers.#", "1")
+}
+
+func TestCephRBDMirrorPool_Import(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("vms", nil)
+	_ = client.SetMirrorMode("vms", sdk.MirrorModePool)
+	r := resourceCephRBDMirrorPool()
+
+	state, err := testImport(r, "ceph/vms", meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "mode", "pool")
+	if state.Attributes["bootstrap_token"] == "" {
+		t.Fatal("expect a bootstrap token of imported pools")
+	}
+	if _, err = testImport(r, "ceph/missing", meta); err == nil {
+		t.Fatal("expect error importing a missing pool")
+	}
+}
@@ -0,0 +1,139 @@
+package ceph
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	log "github.com/sirupsen/logrus"
+)
+
+func resourceCephRBDNamespace() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceCephRBDNamespaceCreate,
+		ReadContext:   resourceCephRBDNamespaceRead,
+		DeleteContext: resourceCephRBDNamespaceDelete,
+		Schema: map[string]*schema.Schema{
+			"pool_id": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				Description:  "$cluster_name/$pool_name",
+				ValidateFunc: validation.NoZeroValues,
+			},
+			"name": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringMatch(regexp.MustCompile(`^[^/@\s]+$`), "must not be empty, contain spaces, slashes or @"),
+			},
+		},
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceCephRBDNamespaceImport,
+		},
+	}
+}
+
+func resourceCephRBDNamespaceCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("create resource ceph_rbd_namespace")
+	cluster, poolName, err := sdk.ParseCephPool(d.Get("pool_id").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	namespace := d.Get("name").(string)
+	key := fmt.Sprintf("%s/%s/%s", cluster, poolName, namespace)
+	if err = client.GetMutexKV().LockContext(ctx, key); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(key)
+
+	namespaces, err := client.ListRBDNamespaces(poolName)
+	if err != nil {
+		return diag.FromErr(err)
+	} else if InSlice(namespace, namespaces) {
+		log.Infof("rbd namespace '%s' already exists", key)
+	} else {
+		log.Infof("create rbd namespace '%s' ...", key)
+		if err = client.CreateRBDNamespace(poolName, namespace); err != nil {
+			return diag.Errorf("create rbd namespace '%s' failed: %v", key, err)
+		}
+	}
+
+	d.SetId(key)
+	log.Infof("RBD namespace ID: %s", d.Id())
+	return resourceCephRBDNamespaceRead(ctx, d, meta)
+}
+
+// resourceCephRBDNamespaceImport imports namespaces by {cluster}/{pool}/{namespace}
+func resourceCephRBDNamespaceImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	cluster, poolName, namespace, err := sdk.ParseCephNamespace(normalizeImportID(d.Id()))
+	if err != nil {
+		return nil, err
+	}
+	return importByRead(ctx, d, meta, "rbd namespace", fmt.Sprintf("%s/%s/%s", cluster, poolName, namespace), resourceCephRBDNamespaceRead)
+}
+
+func resourceCephRBDNamespaceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("read resource ceph_rbd_namespace")
+	cluster, poolName, namespace, err := sdk.ParseCephNamespace(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if ok, err := client.ExistPool(poolName); err != nil {
+		return diag.FromErr(err)
+	} else if !ok {
+		log.Warnf("storage pool of rbd namespace '%s' may have been deleted outside Terraform", d.Id())
+		d.SetId("")
+		return nil
+	}
+	namespaces, err := client.ListRBDNamespaces(poolName)
+	if err != nil {
+		return diag.FromErr(err)
+	} else if !InSlice(namespace, namespaces) {
+		log.Warnf("rbd namespace '%s' may have been deleted outside Terraform", d.Id())
+		d.SetId("")
+		return nil
+	}
+
+	_ = d.Set("pool_id", fmt.Sprintf("%s/%s", cluster, poolName))
+	_ = d.Set("name", namespace)
+	return nil
+}
+
+func resourceCephRBDNamespaceDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	log.Debugf("delete resource ceph_rbd_namespace")
+	cluster, poolName, namespace, err := sdk.ParseCephNamespace(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err = client.GetMutexKV().LockContext(ctx, d.Id()); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(d.Id())
+
+	log.Infof("delete rbd namespace '%s' ...", d.Id())
+	if err = client.DeleteRBDNamespace(poolName, namespace); err != nil {
+		return diag.Errorf("delete rbd namespace '%s' failed: %v", d.Id(), err)
+	}
+	return nil
+}
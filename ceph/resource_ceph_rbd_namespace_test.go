@@ -0,0 +1,130 @@
+package ceph
+
+import (
+	"testing"
+)
+
+func TestCephRBDNamespace_Basic(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephRBDNamespace()
+	config := map[string]interface{}{"pool_id": "ceph/pool1", "name": "tenant1"}
+
+	state := testMustApply(t, r, nil, config, meta)
+	if state.ID != "ceph/pool1/tenant1" {
+		t.Fatalf("expect id ceph/pool1/tenant1, got %s", state.ID)
+	}
+	if namespaces, _ := client.ListRBDNamespaces("pool1"); len(namespaces) != 1 || namespaces[0] != "tenant1" {
+		t.Fatalf("expect namespace tenant1, got %v", namespaces)
+	}
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	_, _ = client.CreateVol("pool1", "tenant1", "vol1", 1024, nil)
+	if err := testDestroy(r, state, meta); err == nil {
+		t.Fatal("expect error deleting a namespace with volumes")
+	}
+	_ = client.DeleteVol("pool1", "tenant1", "vol1")
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	if namespaces, _ := client.ListRBDNamespaces("pool1"); len(namespaces) != 0 {
+		t.Fatalf("expect namespace tenant1 to be deleted, got %v", namespaces)
+	}
+}
+
+func TestCephRBDNamespace_Volumes(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_ = client.CreateRBDNamespace("pool1", "tenant1")
+	_ = client.CreateRBDNamespace("pool1", "tenant2")
+	_, _ = client.CreateVol("pool1", "", "vol1", 1024, nil)
+
+	vol := testMustApply(t, resourceCephVolume(), nil, map[string]interface{}{
+		"pool_id":   "ceph/pool1",
+		"namespace": "tenant1",
+		"name":      "vol1",
+		"size":      2048,
+	}, meta)
+	if vol.ID != "ceph/pool1/tenant1/vol1" {
+		t.Fatalf("expect id ceph/pool1/tenant1/vol1, got %s", vol.ID)
+	}
+	testCheckAttr(t, vol, "namespace", "tenant1")
+	testCheckAttr(t, vol, "size", "2048")
+	if img, _ := client.LookupVolByName("pool1", "", "vol1"); img == nil {
+		t.Fatal("expect vol1 outside of the namespace to be kept")
+	} else if size, _ := img.GetSize(); size != 1024 {
+		t.Fatalf("expect vol1 outside of the namespace to be untouched, got size %d", size)
+	}
+
+	snap := testMustApply(t, resourceCephSnapshot(), nil, map[string]interface{}{
+		"name":        "snap1",
+		"base_volume": vol.ID,
+		"protect":     true,
+	}, meta)
+	if snap.ID != "ceph/pool1/tenant1/vol1@snap1" {
+		t.Fatalf("expect id ceph/pool1/tenant1/vol1@snap1, got %s", snap.ID)
+	}
+	testCheckAttr(t, snap, "namespace", "tenant1")
+
+	cloneConfig := map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"namespace":     "tenant2",
+		"name":          "clone1",
+		"base_snapshot": snap.ID,
+	}
+	clone := testMustApply(t, resourceCephVolume(), nil, cloneConfig, meta)
+	testCheckAttr(t, clone, "base_snapshot", "ceph/pool1/tenant1/vol1@snap1")
+	if diff := testPlan(t, resourceCephVolume(), clone, cloneConfig, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after clone, got %#v", diff)
+	}
+
+	if names, _ := client.ListVols("pool1", "tenant2"); len(names) != 1 || names[0] != "clone1" {
+		t.Fatalf("expect clone1 in tenant2, got %v", names)
+	}
+
+	if _, err := testApply(resourceCephVolume(), nil, map[string]interface{}{
+		"pool_id":   "ceph/pool1",
+		"namespace": "tenant3",
+		"name":      "vol1",
+		"size":      1024,
+	}, meta); err == nil {
+		t.Fatal("expect error creating a volume in a missing namespace")
+	}
+}
+
+func TestCephRBDNamespace_Import(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_ = client.CreateRBDNamespace("pool1", "tenant1")
+	_, _ = client.CreateVol("pool1", "tenant1", "vol1", 1024, nil)
+
+	state, err := testImport(resourceCephRBDNamespace(), "ceph/pool1/tenant1", meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "pool_id", "ceph/pool1")
+	testCheckAttr(t, state, "name", "tenant1")
+
+	state, err = testImport(resourceCephVolume(), "ceph/pool1/tenant1/vol1", meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "namespace", "tenant1")
+	testCheckAttr(t, state, "name", "vol1")
+
+	for _, id := range []string{"ceph/pool1", "ceph/pool1/tenant2", "ceph/pool2/tenant1"} {
+		if _, err = testImport(resourceCephRBDNamespace(), id, meta); err == nil {
+			t.Fatalf("expect error importing '%s'", id)
+		}
+	}
+	for _, id := range []string{"ceph/pool1/tenant2/vol1", "ceph/pool1//vol1", "ceph/pool1/tenant1/vol1/x"} {
+		if _, err = testImport(resourceCephVolume(), id, meta); err == nil {
+			t.Fatalf("expect error importing '%s'", id)
+		}
+	}
+}
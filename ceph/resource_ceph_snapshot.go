@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"terraform-provider-ceph/ceph/sdk"
 
@@ -31,14 +32,35 @@ func resourceCephSnapshot() *schema.Resource {
 				Type:         schema.TypeString,
 				Required:     true,
 				ForceNew:     true,
-				Description:  "$cluster_name/$pool_name/$volume_name",
+				Description:  "$cluster_name/$pool_name/[$namespace/]$volume_name",
 				ValidateFunc: validation.NoZeroValues,
 			},
+			"namespace": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "rbd namespace of the base volume",
+			},
 			"protect": {
 				Type:     schema.TypeBool,
 				Optional: true,
 				Computed: true,
 			},
+			"force_flatten_children": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "flatten the clones of the snapshot on delete, delete fails naming them otherwise",
+			},
+			"children": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "ids of the clones of the snapshot",
+			},
+			"child_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
 			//"rollback_datetime": {
 			//	Type:     schema.TypeString,
 			//	Optional: true,
@@ -46,7 +68,10 @@ func resourceCephSnapshot() *schema.Resource {
 			//},
 		},
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceCephSnapshotImport,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(10 * time.Minute),
 		},
 	}
 }
@@ -54,23 +79,28 @@ func resourceCephSnapshot() *schema.Resource {
 func resourceCephSnapshotCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("create resource ceph_snapshot")
 	baseVolume := strings.TrimSpace(d.Get("base_volume").(string))
-	cluster, poolName, volumeName, _, err := sdk.ParseCephVol(baseVolume)
+	cluster, poolName, namespace, volumeName, baseSnapName, err := sdk.ParseCephVol(baseVolume)
 	if err != nil {
 		return diag.FromErr(err)
+	} else if baseSnapName != "" {
+		return diag.Errorf("invalid base volume '%s', correct: {cluster_name}/{pool_name}/[{namespace}/]{volume_name}", baseVolume)
 	}
-	client, err := getClient(cluster, meta)
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
 	snapName := strings.TrimSpace(d.Get("name").(string))
-	snapPath := fmt.Sprintf("%s@%s", baseVolume, snapName)
+	volumePath := sdk.FormatCephVol(cluster, poolName, namespace, volumeName)
+	snapPath := volumePath + "@" + snapName
 	protect := d.Get("protect").(bool)
 
-	client.MutexKV.Lock(volumeName)
-	defer client.MutexKV.Unlock(volumeName)
+	if err = client.GetMutexKV().LockContext(ctx, volumePath); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(volumePath)
 
-	volume, err := client.LookupVolByName(poolName, volumeName)
+	volume, err := client.LookupVolByName(poolName, namespace, volumeName)
 	if err != nil {
 		return diag.FromErr(err)
 	} else if volume == nil {
@@ -123,20 +153,55 @@ func resourceCephSnapshotCreate(ctx context.Context, d *schema.ResourceData, met
 	return resourceCephSnapshotRead(ctx, d, meta)
 }
 
+// resourceCephSnapshotImport imports snapshots by {cluster}/{pool}/[{namespace}/]{volume}@{snapshot}
+func resourceCephSnapshotImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	id := normalizeImportID(d.Id())
+	cluster, poolName, namespace, volumeName, snapName, err := sdk.ParseCephVol(id)
+	if err != nil {
+		return nil, err
+	} else if snapName == "" {
+		return nil, fmt.Errorf("ceph snapshot format illegal: '%s', need {cluster}/{pool}/[{namespace}/]{volume}@{snapshot}", id)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := client.ExistPool(poolName); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("storage pool '%s/%s' not found", cluster, poolName)
+	}
+	volume, err := client.LookupVolByName(poolName, namespace, volumeName)
+	if err != nil {
+		return nil, err
+	} else if volume == nil {
+		return nil, fmt.Errorf("volume '%s' not found", sdk.FormatCephVol(cluster, poolName, namespace, volumeName))
+	}
+	volume.Close()
+
+	_ = d.Set("force_flatten_children", false)
+	return importByRead(ctx, d, meta, "snapshot", sdk.FormatCephVol(cluster, poolName, namespace, volumeName)+"@"+snapName, resourceCephSnapshotRead)
+}
+
 // resourceCephSnapshotRead returns the current state for a volume resource
 func resourceCephSnapshotRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("read resource ceph_snapshot")
-	cluster, poolName, volumeName, snapName, _ := sdk.ParseCephVol(d.Id())
-	client, err := getClient(cluster, meta)
+	cluster, poolName, namespace, volumeName, snapName, err := sdk.ParseCephVol(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	} else if snapName == "" {
+		return diag.Errorf("ceph snapshot format illegal: '%s', need {cluster}/{pool}/[{namespace}/]{volume}@{snapshot}", d.Id())
+	}
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	volume, err := client.LookupVolByName(poolName, volumeName)
+	volume, err := client.LookupVolByName(poolName, namespace, volumeName)
 	if err != nil {
 		return diag.FromErr(err)
 	} else if volume == nil {
-		return diag.Errorf("volume '%s/%s/%s' not exists", cluster, poolName, volumeName)
+		return diag.Errorf("volume '%s' not exists", sdk.FormatCephVol(cluster, poolName, namespace, volumeName))
 	}
 	defer volume.Close()
 
@@ -150,29 +215,47 @@ func resourceCephSnapshotRead(ctx context.Context, d *schema.ResourceData, meta
 	}
 
 	d.Set("name", snapName)
-	d.Set("base_volume", fmt.Sprintf("%s/%s/%s", cluster, poolName, volumeName))
+	d.Set("base_volume", sdk.FormatCephVol(cluster, poolName, namespace, volumeName))
+	d.Set("namespace", namespace)
 	isProtected, err := snapshot.IsProtected()
 	if err != nil {
 		return diag.FromErr(err)
 	}
 	d.Set("protect", isProtected)
+	children, err := snapshot.ListChildren()
+	if err != nil {
+		return diag.Errorf("list clones of snapshot '%s' failed: %v", d.Id(), err)
+	}
+	d.Set("children", children)
+	d.Set("child_count", len(children))
 	return nil
 }
 
 // resourceCephSnapshotUpdate update a volume resource
 func resourceCephSnapshotUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("update resource ceph_snapshot")
-	cluster, poolName, volumeName, snapName, _ := sdk.ParseCephVol(d.Id())
-	client, err := getClient(cluster, meta)
+	cluster, poolName, namespace, volumeName, snapName, err := sdk.ParseCephVol(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	} else if snapName == "" {
+		return diag.Errorf("ceph snapshot format illegal: '%s', need {cluster}/{pool}/[{namespace}/]{volume}@{snapshot}", d.Id())
+	}
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	volume, err := client.LookupVolByName(poolName, volumeName)
+	volumePath := sdk.FormatCephVol(cluster, poolName, namespace, volumeName)
+	if err = client.GetMutexKV().LockContext(ctx, volumePath); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(volumePath)
+
+	volume, err := client.LookupVolByName(poolName, namespace, volumeName)
 	if err != nil {
 		return diag.FromErr(err)
 	} else if volume == nil {
-		return diag.Errorf("volume '%s/%s/%s' not exists", cluster, poolName, volumeName)
+		return diag.Errorf("volume '%s' not exists", volumePath)
 	}
 	defer volume.Close()
 
@@ -226,17 +309,46 @@ func resourceCephSnapshotUpdate(ctx context.Context, d *schema.ResourceData, met
 // resourceCephSnapshotDelete removed a volume resource
 func resourceCephSnapshotDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("delete resource ceph_snapshot")
-	cluster, poolName, volumeName, snapName, _ := sdk.ParseCephVol(d.Id())
-	client, err := getClient(cluster, meta)
+	cluster, poolName, namespace, volumeName, snapName, err := sdk.ParseCephVol(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	} else if snapName == "" {
+		return diag.Errorf("ceph snapshot format illegal: '%s', need {cluster}/{pool}/[{namespace}/]{volume}@{snapshot}", d.Id())
+	}
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	client.MutexKV.Lock(volumeName)
-	defer client.MutexKV.Unlock(volumeName)
+	volumePath := sdk.FormatCephVol(cluster, poolName, namespace, volumeName)
+	if err = client.GetMutexKV().LockContext(ctx, volumePath); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(volumePath)
+
+	volume, err := client.LookupVolByName(poolName, namespace, volumeName)
+	if err != nil {
+		return diag.FromErr(err)
+	} else if volume == nil {
+		return nil
+	}
+	defer volume.Close()
+	snapshot, err := volume.LookupSnapByName(snapName)
+	if err != nil {
+		return diag.FromErr(err)
+	} else if snapshot == nil {
+		return nil
+	}
+	children, err := snapshot.ListChildren()
+	if err != nil {
+		return diag.Errorf("list clones of snapshot '%s' failed: %v", d.Id(), err)
+	}
+	if err = flattenChildren(ctx, d, client, d.Id(), children); err != nil {
+		return diag.FromErr(err)
+	}
 
 	log.Infof("delete snapshot '%s' ...", d.Id())
-	return diag.FromErr(client.DeleteSnap(poolName, volumeName, snapName))
+	return diag.FromErr(snapshot.Remove())
 }
 
 //// resourceCephSnapshotExists returns True if the volume resource exists
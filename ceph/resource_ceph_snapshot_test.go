@@ -0,0 +1,166 @@
+package ceph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCephSnapshot_Basic(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_, _ = client.CreateVol("pool1", "", "vol1", 1024, nil)
+	r := resourceCephSnapshot()
+	config := map[string]interface{}{
+		"name":        "snap1",
+		"base_volume": "ceph/pool1/vol1",
+		"protect":     true,
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	if state.ID != "ceph/pool1/vol1@snap1" {
+		t.Fatalf("expect id ceph/pool1/vol1@snap1, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "protect", "true")
+
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	config["protect"] = false
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "protect", "false")
+
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	vol, _ := client.LookupVolByName("pool1", "", "vol1")
+	if snap, _ := vol.LookupSnapByName("snap1"); snap != nil {
+		t.Fatal("snap1 not deleted")
+	}
+}
+
+func TestCephSnapshot_MissingVolume(t *testing.T) {
+	meta := testMeta("ceph")
+	_ = testFakeClient(t, meta, "ceph").CreatePool("pool1", nil)
+
+	_, err := testApply(resourceCephSnapshot(), nil, map[string]interface{}{
+		"name":        "snap1",
+		"base_volume": "ceph/pool1/vol1",
+	}, meta)
+	if err == nil {
+		t.Fatal("expect error for missing base volume")
+	}
+}
+
+func TestCephSnapshot_UnprotectWithChildren(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_, _ = client.CreateVol("pool1", "", "vol1", 1024, nil)
+	r := resourceCephSnapshot()
+	config := map[string]interface{}{
+		"name":        "snap1",
+		"base_volume": "ceph/pool1/vol1",
+		"protect":     true,
+	}
+	state := testMustApply(t, r, nil, config, meta)
+	if _, err := client.CloneImg("pool1", "", "vol1", "snap1", "pool1", "", "vol2", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	config["protect"] = false
+	if _, err := testApply(r, state, config, meta); err == nil {
+		t.Fatal("expect unprotect to fail while the snapshot has children")
+	}
+	if err := testDestroy(r, state, meta); err == nil {
+		t.Fatal("expect destroy to fail while the snapshot has children")
+	}
+}
+
+func TestCephSnapshot_Children(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_, _ = client.CreateVol("pool1", "", "vol1", 1024, nil)
+	r := resourceCephSnapshot()
+	state := testMustApply(t, r, nil, map[string]interface{}{
+		"name":        "snap1",
+		"base_volume": "ceph/pool1/vol1",
+		"protect":     true,
+	}, meta)
+	testCheckAttr(t, state, "child_count", "0")
+
+	_, _ = client.CloneImg("pool1", "", "vol1", "snap1", "pool1", "", "vm2", nil)
+	_, _ = client.CloneImg("pool1", "", "vol1", "snap1", "pool1", "", "vm1", nil)
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "child_count", "2")
+	testCheckAttr(t, state, "children.0", "ceph/pool1/vm1")
+	testCheckAttr(t, state, "children.1", "ceph/pool1/vm2")
+}
+
+func TestCephSnapshot_DeleteWithChildren(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_ = client.CreatePool("pool2", nil)
+	_, _ = client.CreateVol("pool1", "", "vol1", 1024, nil)
+	r := resourceCephSnapshot()
+	config := map[string]interface{}{
+		"name":        "snap1",
+		"base_volume": "ceph/pool1/vol1",
+		"protect":     true,
+	}
+	state := testMustApply(t, r, nil, config, meta)
+	_, _ = client.CloneImg("pool1", "", "vol1", "snap1", "pool1", "", "vm2", nil)
+	_, _ = client.CloneImg("pool1", "", "vol1", "snap1", "pool2", "", "vm1", nil)
+
+	err := testDestroy(r, state, meta)
+	if err == nil || !strings.Contains(err.Error(), "has clone children: ceph/pool1/vm2, ceph/pool2/vm1") {
+		t.Fatalf("expect destroy to fail naming the clones, got %v", err)
+	}
+
+	config["force_flatten_children"] = true
+	state = testMustApply(t, r, state, config, meta)
+	if err = testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"pool1/vm2", "pool2/vm1"} {
+		parts := strings.Split(id, "/")
+		vol, _ := client.LookupVolByName(parts[0], "", parts[1])
+		if parent, _ := vol.GetParent(); parent != "" {
+			t.Fatalf("expect clone %s to be flattened, parent is %s", id, parent)
+		}
+	}
+}
+
+func TestCephSnapshot_Import(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	vol, _ := client.CreateVol("pool1", "", "vol1", 1024, nil)
+	snap, _ := vol.CreateSnapshot("snap1")
+	_ = snap.Protect()
+	r := resourceCephSnapshot()
+
+	state, err := testImport(r, "ceph/pool1/vol1@snap1", meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "name", "snap1")
+	testCheckAttr(t, state, "base_volume", "ceph/pool1/vol1")
+	testCheckAttr(t, state, "protect", "true")
+	if diff := testPlan(t, r, state, map[string]interface{}{
+		"name":        "snap1",
+		"base_volume": "ceph/pool1/vol1",
+		"protect":     true,
+	}, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after import, got %#v", diff)
+	}
+
+	for _, id := range []string{"ceph/pool1/vol1", "ceph/pool1/vol1@", "pool1/vol1@snap1", "ceph/pool1/vol2@snap1", "ceph/pool1/vol1@snap2"} {
+		if _, err = testImport(r, id, meta); err == nil {
+			t.Fatalf("expect error importing '%s'", id)
+		}
+	}
+}
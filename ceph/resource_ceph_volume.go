@@ -3,22 +3,52 @@ package ceph
 import (
 	"context"
 	"fmt"
+	"math/bits"
+	"regexp"
 	"strings"
+	"time"
 
 	"terraform-provider-ceph/ceph/sdk"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	log "github.com/sirupsen/logrus"
 )
 
+// volumeFeatures are the image features managed by `features`, in the order
+// they are enabled, they are disabled in reverse order
+var volumeFeatures = []string{
+	sdk.FeatureNameLayering,
+	sdk.FeatureNameExclusiveLock,
+	sdk.FeatureNameObjectMap,
+	sdk.FeatureNameFastDiff,
+	sdk.FeatureNameDeepFlatten,
+	sdk.FeatureNameJournaling,
+}
+
+// clone modes of volumes with base_snapshot
+const (
+	cloneModeClone           = "clone"
+	cloneModeCloneAndFlatten = "clone_and_flatten"
+	cloneModeDeepCopy        = "deep_copy"
+)
+
+// deletion policies of volumes, what destroy does with the image
+const (
+	deletionPolicyDelete = "delete"
+	deletionPolicyTrash  = "trash"
+	deletionPolicyRetain = "retain"
+)
+
 func resourceCephVolume() *schema.Resource {
 	return &schema.Resource{
 		CreateContext: resourceCephVolumeCreate,
 		ReadContext:   resourceCephVolumeRead,
 		DeleteContext: resourceCephVolumeDelete,
 		UpdateContext: resourceCephVolumeUpdate,
+		CustomizeDiff: customdiff.All(resourceCephVolumeValidateFeatures, resourceCephVolumeValidateCloneMode, resourceCephVolumeValidateSize),
 		//Exists: resourceCephVolumeExists,
 		Schema: map[string]*schema.Schema{
 			"pool_id": {
@@ -28,6 +58,14 @@ func resourceCephVolume() *schema.Resource {
 				Description:  "$cluster_name/$pool_name",
 				ValidateFunc: validation.NoZeroValues,
 			},
+			"namespace": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ForceNew:     true,
+				Description:  "rbd namespace of the pool, the volume id is $cluster_name/$pool_name/$namespace/$volume_name if set",
+				ValidateFunc: validation.StringMatch(regexp.MustCompile(`^[^/@\s]*$`), "must not contain spaces, slashes or @"),
+			},
 			"name": {
 				Type:         schema.TypeString,
 				Required:     true,
@@ -39,104 +77,361 @@ func resourceCephVolume() *schema.Resource {
 				Optional: true,
 				Computed: true,
 			},
+			"data_pool": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				ForceNew:    true,
+				Description: "pool storing the image data, e.g. an erasure coded pool with `allow_ec_overwrites`",
+			},
+			"object_size": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				Description:  "object size in bytes, a power of two between 4K and 32M, default is 4M",
+				ValidateFunc: validateObjectSize,
+			},
+			"features": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.StringInSlice(volumeFeatures, false),
+				},
+				Description: "image features, exclusive-lock, object-map, fast-diff and journaling can be toggled in place",
+			},
+			"stripe_unit": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				RequiredWith: []string{"stripe_count"},
+				Description:  "stripe unit in bytes, must divide the object size",
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"stripe_count": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				RequiredWith: []string{"stripe_unit"},
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"allow_shrink": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "allow `size` to be decreased, data beyond the new size is lost",
+			},
 			"base_snapshot": {
 				Type:     schema.TypeString,
 				Optional: true,
 				//TODO 如果开启Computed参数, 这个字段会读不到变更, 原因未知
 				//Computed:      true,
 				ConflictsWith: []string{"size"},
-				Description:   "$cluster_name/$pool_name/$volume_name@$snapshot_name",
+				Description:   "$cluster_name/$pool_name/[$namespace/]$volume_name@$snapshot_name",
+			},
+			"clone_mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      cloneModeClone,
+				Description:  "how the volume is created from base_snapshot: clone (copy on write child), clone_and_flatten or deep_copy (with the snapshots up to base_snapshot)",
+				ValidateFunc: validation.StringInSlice([]string{cloneModeClone, cloneModeCloneAndFlatten, cloneModeDeepCopy}, false),
+			},
+			"copy_from": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"size", "base_snapshot"},
+				Description:   "$cluster_name/$pool_name/[$namespace/]$volume_name@$snapshot_name of any configured cluster, the data is copied to a new independent volume",
 			},
 			"rollback_snapshot_name": {
 				Type:     schema.TypeString,
 				Optional: true,
 				Default:  "",
 			},
+			"deletion_policy": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      deletionPolicyDelete,
+				Description:  "what destroy does with the image: delete it, move it to the trash of the pool or retain it in ceph",
+				ValidateFunc: validation.StringInSlice([]string{deletionPolicyDelete, deletionPolicyTrash, deletionPolicyRetain}, false),
+			},
+			"trash_delay": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "0s",
+				Description:  "with deletion_policy trash, the image can't be purged from the trash before the delay is over, e.g. 168h",
+				ValidateFunc: validateDuration,
+			},
+			"restore_from_trash": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "restore the latest image of the same name from the trash on create instead of creating a new one",
+			},
+			"force_flatten_children": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "flatten the clones of the snapshots of the volume on delete, delete fails naming them otherwise",
+			},
+			"metadata": {
+				Type:         schema.TypeMap,
+				Optional:     true,
+				Computed:     true,
+				Elem:         &schema.Schema{Type: schema.TypeString},
+				Description:  "image metadata like `rbd image-meta set`, keys missing here are removed, config overrides (conf_*) excepted, not managed if unset",
+				ValidateFunc: validateMetadata,
+			},
+			"qos": qosSchema("io limits of the volume by rbd_qos_* option without prefix, config overrides of the image like `rbd config image set`, 0 is unlimited, unset options inherit the limit of the pool, not managed if unset", true),
+			"mirroring": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Computed:    true,
+				MaxItems:    1,
+				Description: "rbd mirroring of the volume, the pool must be mirrored in image mode, not managed if unset",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"enabled": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"mode": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      sdk.MirrorImageModeSnapshot,
+							Description:  "journal or snapshot, journal requires the journaling feature, can't be changed while enabled",
+							ValidateFunc: validation.StringInSlice([]string{sdk.MirrorImageModeJournal, sdk.MirrorImageModeSnapshot}, false),
+						},
+						"primary": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     true,
+							Description: "false demotes the image, true promotes it",
+						},
+						"force_promote": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     false,
+							Description: "promote even though the peer's image isn't demoted, e.g. when the peer site is down",
+						},
+						"global_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"state": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+			"parent_pool": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "pool of the parent snapshot, empty if the volume isn't a clone",
+			},
+			"parent_namespace": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "rbd namespace of the parent snapshot",
+			},
+			"parent_image": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "volume of the parent snapshot",
+			},
+			"parent_snapshot": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "name of the parent snapshot",
+			},
+			"overlap": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "bytes of the clone still backed by the parent snapshot",
+			},
+			"clone_depth": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "number of ancestors of the clone, 0 if the volume isn't a clone",
+			},
+			"children": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "ids of the clones of the snapshots of the volume",
+			},
 		},
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceCephVolumeImport,
+		},
+		// flatten, deep copy, copy_from and rollback run as long as the data
+		// to copy takes, they are aborted when the timeout is reached
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(10 * time.Minute),
+			Create:  schema.DefaultTimeout(60 * time.Minute),
+			Update:  schema.DefaultTimeout(60 * time.Minute),
 		},
 	}
 }
 
 func resourceCephVolumeCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("create resource ceph_volume")
-	path := strings.Split(d.Get("pool_id").(string), "/")
-	if len(path) != 2 {
-		return diag.Errorf("invalid format, correct: {cluster_name}/{pool_name}")
+	cluster, poolName, err := sdk.ParseCephPool(d.Get("pool_id").(string))
+	if err != nil {
+		return diag.FromErr(err)
 	}
-	cluster := path[0]
-	client, err := getClient(cluster, meta)
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	poolName := path[1]
+	namespace := d.Get("namespace").(string)
 	volumeName := strings.TrimSpace(d.Get("name").(string))
-	volumePath := fmt.Sprintf("%s/%s/%s", cluster, poolName, volumeName)
+	volumePath := sdk.FormatCephVol(cluster, poolName, namespace, volumeName)
 
-	client.MutexKV.Lock(fmt.Sprintf("%s/%s", cluster, poolName))
-	defer client.MutexKV.Unlock(fmt.Sprintf("%s/%s", cluster, poolName))
+	if err = client.GetMutexKV().LockContext(ctx, volumePath); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(volumePath)
 
-	var baseVolumePath, baseVolumeClusterName, baseVolumePoolName, baseVolumeName, baseVolumeSnapName string
+	var baseVolumePath, baseVolumeClusterName, baseVolumePoolName, baseVolumeNamespace, baseVolumeName, baseVolumeSnapName string
 	var size uint64
 	if tmp, ok := d.GetOk("base_snapshot"); ok {
 		baseVolumePath = tmp.(string)
-		baseVolumeClusterName, baseVolumePoolName, baseVolumeName, baseVolumeSnapName, err = sdk.ParseCephVol(baseVolumePath)
+		baseVolumeClusterName, baseVolumePoolName, baseVolumeNamespace, baseVolumeName, baseVolumeSnapName, err = sdk.ParseCephVol(baseVolumePath)
 		if err != nil {
 			return diag.FromErr(err)
 		}
 		if cluster != baseVolumeClusterName {
-			return diag.Errorf("invalid base snapshot from different cluster: %s | %s", baseVolumeClusterName, cluster)
+			return diag.Errorf("invalid base snapshot from different cluster: %s | %s, use copy_from instead", baseVolumeClusterName, cluster)
 		}
 		if baseVolumeSnapName == "" {
 			return diag.Errorf("invalid base snapshot without snapshot name: %s", baseVolumePath)
 		}
-	} else {
-		if _, ok := d.GetOk("size"); ok {
-			size = uint64(d.Get("size").(int))
+	} else if _, ok := d.GetOk("size"); ok {
+		size = uint64(d.Get("size").(int))
+	}
+
+	cloneMode := d.Get("clone_mode").(string)
+	var copyFrom sdk.CephVolumeI
+	if tmp, ok := d.GetOk("copy_from"); ok {
+		if copyFrom, err = openCopySource(ctx, tmp.(string), meta); err != nil {
+			return diag.FromErr(err)
 		}
+		defer copyFrom.Close()
+		if size, err = copyFrom.GetSize(); err != nil {
+			return diag.Errorf("get size of '%s' failed: %v", tmp, err)
+		}
+	}
+
+	config := &sdk.VolumeConfig{
+		DataPool:    d.Get("data_pool").(string),
+		StripeUnit:  uint64(d.Get("stripe_unit").(int)),
+		StripeCount: uint64(d.Get("stripe_count").(int)),
+	}
+	if objectSize, ok := d.GetOk("object_size"); ok {
+		config.Order = uint64(bits.TrailingZeros64(uint64(objectSize.(int))))
+	}
+	if features, ok := d.GetOk("features"); ok {
+		config.Features = uint64(sdk.FeatureSetFromNames(expandStringSet(features.(*schema.Set))))
 	}
 
-	volume, err := client.LookupVolByName(poolName, volumeName)
+	volume, err := client.LookupVolByName(poolName, namespace, volumeName)
 	if err != nil {
 		return diag.FromErr(err)
-	} else if volume == nil {
+	} else if volume == nil && d.Get("restore_from_trash").(bool) {
+		if volume, err = restoreVolume(client, poolName, namespace, volumeName, volumePath); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	if volume == nil {
 		log.Infof("create volume '%s' ...", volumePath)
-		if baseVolumePath != "" {
-			if volume, err = client.CloneImg(baseVolumePoolName, baseVolumeName, baseVolumeSnapName, poolName, volumeName); err != nil {
+		if baseVolumePath != "" && cloneMode == cloneModeDeepCopy {
+			if volume, err = client.DeepCopyImg(ctx, baseVolumePoolName, baseVolumeNamespace, baseVolumeName, baseVolumeSnapName, poolName, namespace, volumeName, config); err != nil {
+				return diag.Errorf("cluster %s %v", cluster, err)
+			}
+		} else if baseVolumePath != "" {
+			if volume, err = client.CloneImg(baseVolumePoolName, baseVolumeNamespace, baseVolumeName, baseVolumeSnapName, poolName, namespace, volumeName, config); err != nil {
 				return diag.Errorf("cluster %s %v", cluster, err)
 			}
+			if cloneMode == cloneModeCloneAndFlatten {
+				log.Infof("flatten volume '%s' ...", volumePath)
+				if err = volume.Flatten(ctx); err != nil {
+					volume.Close()
+					// the clone is tainted and replaced by the next apply
+					d.SetId(volumePath)
+					return diag.Errorf("flatten volume '%s' failed: %v", volumePath, err)
+				}
+			}
 		} else if size > 0 {
-			if volume, err = client.CreateVol(poolName, volumeName, size); err != nil {
+			if volume, err = client.CreateVol(poolName, namespace, volumeName, size, config); err != nil {
 				return diag.Errorf("cluster %s %v", cluster, err)
 			}
 		} else if size == 0 {
-			return diag.Errorf("'size' must be specified when 'base_snapshot' is missing")
+			return diag.Errorf("'size' must be specified when 'base_snapshot' and 'copy_from' are missing")
 		}
 		defer volume.Close()
+
+		if copyFrom != nil {
+			if err = copyVolume(ctx, copyFrom, volume, d.Get("copy_from").(string), volumePath); err != nil {
+				// a partial copy must not be adopted by the next apply
+				if rmErr := client.DeleteVol(poolName, namespace, volumeName); rmErr != nil {
+					log.Errorf("delete partial copy '%s' failed: %v", volumePath, rmErr)
+				}
+				return diag.FromErr(err)
+			}
+		}
 	} else {
 		defer volume.Close()
 
 		parent, err := volume.GetParent()
 		if err != nil {
 			return diag.Errorf("%s get parent failed: %v", volumePath, err)
-		} else if parent != baseVolumePath {
+		} else if parent != baseVolumePath && (cloneMode == cloneModeClone || parent != "") {
 			return diag.Errorf("volume base_snapshot mismatch")
 		}
 
-		if size > 0 {
-			volumeSize, err := volume.GetSize()
+		if config.DataPool != "" {
+			dataPool, err := volume.GetDataPool()
 			if err != nil {
-				return diag.FromErr(err)
-			} else if size != volumeSize {
-				return diag.Errorf("volume already exists, but size mismatch")
+				return diag.Errorf("%s get data pool failed: %v", volumePath, err)
+			} else if dataPool != config.DataPool {
+				return diag.Errorf("volume already exists, but data_pool mismatch: %s", dataPool)
 			}
 		}
+
 		log.Infof("volume '%s' already exists", volumePath)
+		if copyFrom != nil {
+			log.Warnf("volume '%s' already exists, data of copy_from is not copied", volumePath)
+		} else if size > 0 {
+			if err = resizeVolume(volume, volumePath, size, d.Get("allow_shrink").(bool)); err != nil {
+				return diag.FromErr(err)
+			}
+		}
 	}
 
 	d.SetId(volumePath)
+	// a volume with wrong metadata is tainted, unset metadata keeps the one
+	// inherited, adopted or restored from the trash
+	if metadata, ok := d.GetOk("metadata"); ok {
+		if err = updateVolumeMetadata(volume, volumePath, metadata.(map[string]interface{})); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	if _, ok := d.GetOk("qos"); ok {
+		if err = updateVolumeQos(volume, volumePath, expandQos(d)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	if err = updateVolumeMirroring(volume, volumePath, d); err != nil {
+		return diag.FromErr(err)
+	}
 
 	// make sure we record the id even if the rest of this gets interrupted
 	d.Partial(true)
@@ -148,16 +443,119 @@ func resourceCephVolumeCreate(ctx context.Context, d *schema.ResourceData, meta
 	return resourceCephVolumeRead(ctx, d, meta)
 }
 
+// restoreVolume restores the latest trash entry of the volume name, it
+// returns nil if there is none
+func restoreVolume(client sdk.CephClientI, poolName, namespace, volumeName, volumePath string) (sdk.CephVolumeI, error) {
+	entries, err := client.ListTrash(poolName, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("list trash of '%s' failed: %v", volumePath, err)
+	}
+	var latest *sdk.TrashEntry
+	for i := range entries {
+		if entries[i].Name == volumeName {
+			latest = &entries[i]
+		}
+	}
+	if latest == nil {
+		log.Infof("volume '%s' not found in the trash", volumePath)
+		return nil, nil
+	}
+
+	log.Infof("restore volume '%s' from trash entry %s deleted at %s ...", volumePath, latest.ID, latest.DeletionTime.Format(time.RFC3339))
+	if err = client.RestoreVolFromTrash(poolName, namespace, latest.ID, volumeName); err != nil {
+		return nil, fmt.Errorf("restore volume '%s' from trash failed: %v", volumePath, err)
+	}
+	return client.LookupVolByName(poolName, namespace, volumeName)
+}
+
+// openCopySource opens the snapshot of copy_from read-only, it may be in
+// any cluster of the provider
+func openCopySource(ctx context.Context, snapPath string, meta interface{}) (sdk.CephVolumeI, error) {
+	cluster, poolName, namespace, volumeName, snapName, err := sdk.ParseCephVol(snapPath)
+	if err != nil {
+		return nil, err
+	} else if snapName == "" {
+		return nil, fmt.Errorf("invalid copy_from without snapshot name: %s", snapPath)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return nil, err
+	}
+	src, err := client.OpenVolSnapshot(poolName, namespace, volumeName, snapName)
+	if err != nil {
+		return nil, fmt.Errorf("open '%s' failed: %v", snapPath, err)
+	} else if src == nil {
+		return nil, fmt.Errorf("snapshot '%s' not exists", snapPath)
+	}
+	return src, nil
+}
+
+// copyVolume copies the data of the source snapshot to the new volume in
+// chunks of the object size of the source
+func copyVolume(ctx context.Context, src, dst sdk.CephVolumeI, srcPath, dstPath string) error {
+	chunkSize, err := src.GetObjectSize()
+	if err != nil {
+		return fmt.Errorf("get object size of '%s' failed: %v", srcPath, err)
+	}
+	log.Infof("copy '%s' to '%s' ...", srcPath, dstPath)
+	written, err := sdk.CopyVolData(ctx, fmt.Sprintf("copy '%s' to '%s'", srcPath, dstPath), src, dst, chunkSize)
+	if err != nil {
+		return fmt.Errorf("copy '%s' to '%s' failed: %v", srcPath, dstPath, err)
+	}
+	log.Infof("copy '%s' to '%s' finished, %d bytes written", srcPath, dstPath, written)
+	return nil
+}
+
+// resourceCephVolumeImport imports volumes by {cluster}/{pool}/[{namespace}/]{volume}
+func resourceCephVolumeImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	id := normalizeImportID(d.Id())
+	cluster, poolName, namespace, volumeName, snapName, err := sdk.ParseCephVol(id)
+	if err != nil {
+		return nil, err
+	} else if snapName != "" {
+		return nil, fmt.Errorf("ceph volume format illegal: '%s', need {cluster}/{pool}/[{namespace}/]{volume}", id)
+	}
+	client, err := getClient(ctx, cluster, meta)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := client.ExistPool(poolName); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("storage pool '%s/%s' not found", cluster, poolName)
+	}
+	if namespace != "" {
+		namespaces, err := client.ListRBDNamespaces(poolName)
+		if err != nil {
+			return nil, err
+		} else if !InSlice(namespace, namespaces) {
+			return nil, fmt.Errorf("rbd namespace '%s/%s/%s' not found", cluster, poolName, namespace)
+		}
+	}
+
+	_ = d.Set("allow_shrink", false)
+	_ = d.Set("rollback_snapshot_name", "")
+	_ = d.Set("clone_mode", cloneModeClone)
+	_ = d.Set("deletion_policy", deletionPolicyDelete)
+	_ = d.Set("trash_delay", "0s")
+	_ = d.Set("restore_from_trash", false)
+	_ = d.Set("force_flatten_children", false)
+	return importByRead(ctx, d, meta, "volume", sdk.FormatCephVol(cluster, poolName, namespace, volumeName), resourceCephVolumeRead)
+}
+
 // resourceCephVolumeRead returns the current state for a volume resource
 func resourceCephVolumeRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("read resource ceph_volume")
-	cluster, poolName, volumeName, _, _ := sdk.ParseCephVol(d.Id())
-	client, err := getClient(cluster, meta)
+	cluster, poolName, namespace, volumeName, _, err := sdk.ParseCephVol(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	volume, err := client.LookupVolByName(poolName, volumeName)
+	volume, err := client.LookupVolByName(poolName, namespace, volumeName)
 	if err != nil {
 		return diag.FromErr(err)
 	} else if volume == nil {
@@ -168,6 +566,7 @@ func resourceCephVolumeRead(ctx context.Context, d *schema.ResourceData, meta in
 	defer volume.Close()
 
 	d.Set("pool_id", fmt.Sprintf("%s/%s", cluster, poolName))
+	d.Set("namespace", namespace)
 	d.Set("name", volumeName)
 
 	//size, err := volume.GetSize()
@@ -176,12 +575,41 @@ func resourceCephVolumeRead(ctx context.Context, d *schema.ResourceData, meta in
 	//}
 	// d.Set("size", size)
 
-	parent, err := volume.GetParent()
+	parentInfo, err := volume.GetParentInfo()
 	if err != nil {
 		return diag.Errorf("%s get parent failed: %v", d.Id(), err)
 	}
+	var parent string
+	if parentInfo != nil {
+		parent = sdk.FormatCephVol(cluster, parentInfo.Pool, parentInfo.Namespace, parentInfo.Image) + "@" + parentInfo.Snapshot
+		d.Set("parent_pool", parentInfo.Pool)
+		d.Set("parent_namespace", parentInfo.Namespace)
+		d.Set("parent_image", parentInfo.Image)
+		d.Set("parent_snapshot", parentInfo.Snapshot)
+		d.Set("overlap", parentInfo.Overlap)
+	} else {
+		d.Set("parent_pool", "")
+		d.Set("parent_namespace", "")
+		d.Set("parent_image", "")
+		d.Set("parent_snapshot", "")
+		d.Set("overlap", 0)
+	}
 	log.Infof("%s get parent: %s", d.Id(), parent)
-	d.Set("base_snapshot", parent)
+	depth, err := cloneDepth(client, parentInfo)
+	if err != nil {
+		return diag.Errorf("%s get clone depth failed: %v", d.Id(), err)
+	}
+	d.Set("clone_depth", depth)
+	children, err := volume.ListChildren()
+	if err != nil {
+		return diag.Errorf("%s list clones failed: %v", d.Id(), err)
+	}
+	d.Set("children", children)
+	// flattened volumes and deep copies keep base_snapshot as their source,
+	// the data source has no clone_mode
+	if cloneMode, _ := d.Get("clone_mode").(string); parent != "" || (cloneMode != cloneModeCloneAndFlatten && cloneMode != cloneModeDeepCopy) {
+		d.Set("base_snapshot", parent)
+	}
 
 	size, err := volume.GetSize()
 	if err != nil {
@@ -189,24 +617,115 @@ func resourceCephVolumeRead(ctx context.Context, d *schema.ResourceData, meta in
 	}
 	d.Set("size", size)
 
+	dataPool, err := volume.GetDataPool()
+	if err != nil {
+		return diag.Errorf("%s get data pool failed: %v", d.Id(), err)
+	}
+	d.Set("data_pool", dataPool)
+
+	objectSize, err := volume.GetObjectSize()
+	if err != nil {
+		return diag.Errorf("%s get object size failed: %v", d.Id(), err)
+	}
+	d.Set("object_size", objectSize)
+
+	stripeUnit, err := volume.GetStripeUnit()
+	if err != nil {
+		return diag.Errorf("%s get stripe unit failed: %v", d.Id(), err)
+	}
+	d.Set("stripe_unit", stripeUnit)
+
+	stripeCount, err := volume.GetStripeCount()
+	if err != nil {
+		return diag.Errorf("%s get stripe count failed: %v", d.Id(), err)
+	}
+	d.Set("stripe_count", stripeCount)
+
+	features, err := volume.GetFeatures()
+	if err != nil {
+		return diag.Errorf("%s get features failed: %v", d.Id(), err)
+	}
+	enabled := sdk.FeatureSet(features)
+	featureNames := make([]string, 0, len(volumeFeatures))
+	for _, name := range enabled.Names() {
+		for _, feature := range volumeFeatures {
+			if name == feature {
+				featureNames = append(featureNames, name)
+			}
+		}
+	}
+	d.Set("features", featureNames)
+
+	metadata, err := volume.ListMetadata()
+	if err != nil {
+		return diag.Errorf("%s list metadata failed: %v", d.Id(), err)
+	}
+	qos, err := flattenQos(metadata)
+	if err != nil {
+		return diag.Errorf("%s %v", d.Id(), err)
+	}
+	d.Set("qos", qos)
+	for key := range metadata {
+		if strings.HasPrefix(key, sdk.ConfMetadataPrefix) {
+			delete(metadata, key)
+		}
+	}
+	d.Set("metadata", metadata)
+
+	mirrorInfo, err := volume.GetMirrorInfo()
+	if err != nil {
+		return diag.Errorf("%s get mirroring failed: %v", d.Id(), err)
+	}
+	d.Set("mirroring", flattenVolumeMirroring(d, mirrorInfo))
+
 	//d.Set("rollback_snapshot_name", "")
 	return nil
 }
 
+// cloneDepth returns the number of ancestors of a volume with the given
+// parent. Ancestors in the trash can't be opened by name, the walk stops at
+// them.
+func cloneDepth(client sdk.CephClientI, parent *sdk.ParentInfo) (int, error) {
+	depth := 0
+	for parent != nil {
+		depth++
+		volume, err := client.LookupVolByName(parent.Pool, parent.Namespace, parent.Image)
+		if err != nil {
+			return 0, err
+		} else if volume == nil {
+			break
+		}
+		parent, err = volume.GetParentInfo()
+		volume.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return depth, nil
+}
+
 // resourceCephVolumeUpdate update a volume resource
 func resourceCephVolumeUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("update resource ceph_volume")
-	cluster, poolName, volumeName, _, _ := sdk.ParseCephVol(d.Id())
-	client, err := getClient(cluster, meta)
+	cluster, poolName, namespace, volumeName, _, err := sdk.ParseCephVol(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	volume, err := client.LookupVolByName(poolName, volumeName)
+	if err = client.GetMutexKV().LockContext(ctx, d.Id()); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(d.Id())
+
+	volume, err := client.LookupVolByName(poolName, namespace, volumeName)
 	if err != nil {
 		return diag.FromErr(err)
 	} else if volume == nil {
-		return diag.Errorf("volume '%s/%s/%s' not exists", cluster, poolName, volumeName)
+		return diag.Errorf("volume '%s' not exists", d.Id())
 	}
 	defer volume.Close()
 
@@ -221,12 +740,57 @@ func resourceCephVolumeUpdate(ctx context.Context, d *schema.ResourceData, meta
 		if tmp, ok := d.GetOk("base_snapshot"); ok && (strings.TrimSpace(tmp.(string)) != "") {
 			return diag.Errorf("`base_snapshot` can't be set for existing volume: %s", d.Id())
 		} else if (strings.TrimSpace(tmp.(string)) == "" || !ok) && (parent != "") {
-			if err = volume.Flatten(); err != nil {
+			if err = volume.Flatten(ctx); err != nil {
 				return diag.Errorf("cluster %s %v", cluster, err)
 			}
 		}
 	}
 
+	if d.HasChange("clone_mode") && d.Get("clone_mode").(string) != cloneModeClone {
+		parent, err := volume.GetParent()
+		if err != nil {
+			return diag.Errorf("%s get parent failed: %v", d.Id(), err)
+		} else if parent != "" {
+			log.Infof("flatten volume '%s' ...", d.Id())
+			if err = volume.Flatten(ctx); err != nil {
+				return diag.Errorf("flatten volume '%s' failed: %v", d.Id(), err)
+			}
+		}
+	}
+
+	if d.HasChange("size") {
+		if size := uint64(d.Get("size").(int)); size > 0 {
+			if err = resizeVolume(volume, d.Id(), size, d.Get("allow_shrink").(bool)); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	if d.HasChange("features") {
+		o, n := d.GetChange("features")
+		if err = updateVolumeFeatures(volume, d.Id(), o.(*schema.Set), n.(*schema.Set)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange("metadata") {
+		if err = updateVolumeMetadata(volume, d.Id(), d.Get("metadata").(map[string]interface{})); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange("qos") {
+		if err = updateVolumeQos(volume, d.Id(), expandQos(d)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange("mirroring") {
+		if err = updateVolumeMirroring(volume, d.Id(), d); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
 	if d.HasChange("rollback_snapshot_name") {
 		snapName := d.Get("rollback_snapshot_name").(string)
 		if snapName != "" {
@@ -238,7 +802,7 @@ func resourceCephVolumeUpdate(ctx context.Context, d *schema.ResourceData, meta
 			}
 
 			log.Infof("rollback snapshot '%s@%s' ...", d.Id(), snapName)
-			if err = snapshot.Rollback(); err != nil {
+			if err = snapshot.Rollback(ctx); err != nil {
 				return diag.Errorf("rollback snapshot '%s@%s' failed: %s", d.Id(), snapName, err.Error())
 			}
 			log.Infof("rollback snapshot '%s@%s' finished", d.Id(), snapName)
@@ -246,23 +810,350 @@ func resourceCephVolumeUpdate(ctx context.Context, d *schema.ResourceData, meta
 	}
 
 	d.Partial(false)
+	return resourceCephVolumeRead(ctx, d, meta)
+}
+
+// resizeVolume resizes volume in place, shrinking is refused unless allowShrink
+func resizeVolume(volume sdk.CephVolumeI, volumePath string, size uint64, allowShrink bool) error {
+	volumeSize, err := volume.GetSize()
+	if err != nil {
+		return fmt.Errorf("%s get size failed: %v", volumePath, err)
+	} else if size == volumeSize {
+		return nil
+	} else if size < volumeSize && !allowShrink {
+		return fmt.Errorf("volume '%s' can't shrink from %d to %d bytes unless `allow_shrink` is set", volumePath, volumeSize, size)
+	}
+
+	log.Infof("resize volume '%s' from %d to %d bytes ...", volumePath, volumeSize, size)
+	if err = volume.Resize(size); err != nil {
+		return fmt.Errorf("resize volume '%s' failed: %v", volumePath, err)
+	}
+	return nil
+}
+
+// updateVolumeFeatures disables the features removed from old then enables
+// the new ones, one at a time so that the dependencies between them hold
+func updateVolumeFeatures(volume sdk.CephVolumeI, volumePath string, old, new *schema.Set) error {
+	for i := len(volumeFeatures) - 1; i >= 0; i-- {
+		name := volumeFeatures[i]
+		if old.Contains(name) && !new.Contains(name) {
+			log.Infof("disable feature %s of volume '%s' ...", name, volumePath)
+			if err := volume.UpdateFeatures(uint64(sdk.FeatureSetFromNames([]string{name})), false); err != nil {
+				return fmt.Errorf("disable feature %s of volume '%s' failed: %v", name, volumePath, err)
+			}
+		}
+	}
+	for _, name := range volumeFeatures {
+		if new.Contains(name) && !old.Contains(name) {
+			log.Infof("enable feature %s of volume '%s' ...", name, volumePath)
+			if err := volume.UpdateFeatures(uint64(sdk.FeatureSetFromNames([]string{name})), true); err != nil {
+				return fmt.Errorf("enable feature %s of volume '%s' failed: %v", name, volumePath, err)
+			}
+		}
+	}
 	return nil
 }
 
+// updateVolumeMetadata sets the metadata of the volume to metadata, keys of
+// config overrides are left alone
+func updateVolumeMetadata(volume sdk.CephVolumeI, volumePath string, metadata map[string]interface{}) error {
+	current, err := volume.ListMetadata()
+	if err != nil {
+		return fmt.Errorf("%s list metadata failed: %v", volumePath, err)
+	}
+	for key := range current {
+		if _, ok := metadata[key]; !ok && !strings.HasPrefix(key, sdk.ConfMetadataPrefix) {
+			log.Infof("remove metadata %s of volume '%s'", key, volumePath)
+			if err = volume.RemoveMetadata(key); err != nil {
+				return fmt.Errorf("remove metadata %s of volume '%s' failed: %v", key, volumePath, err)
+			}
+		}
+	}
+	for key, value := range metadata {
+		if v, ok := current[key]; ok && v == value.(string) {
+			continue
+		}
+		log.Infof("set metadata %s of volume '%s'", key, volumePath)
+		if err = volume.SetMetadata(key, value.(string)); err != nil {
+			return fmt.Errorf("set metadata %s of volume '%s' failed: %v", key, volumePath, err)
+		}
+	}
+	return nil
+}
+
+// updateVolumeQos sets the qos config overrides of the volume to qos
+func updateVolumeQos(volume sdk.CephVolumeI, volumePath string, qos map[string]string) error {
+	current, err := volume.ListMetadata()
+	if err != nil {
+		return fmt.Errorf("%s list metadata failed: %v", volumePath, err)
+	}
+	return updateQos(current, qos, fmt.Sprintf("volume '%s'", volumePath), volume.SetMetadata, volume.RemoveMetadata)
+}
+
+// flattenVolumeMirroring returns the mirroring block, none if the volume
+// isn't mirrored and the block isn't in the state. The settings of disabled
+// mirroring are kept from the state.
+func flattenVolumeMirroring(d *schema.ResourceData, info *sdk.MirrorImageInfo) []interface{} {
+	blocks := d.Get("mirroring").([]interface{})
+	if !info.Enabled() && (len(blocks) == 0 || blocks[0] == nil) {
+		return nil
+	}
+	block := map[string]interface{}{
+		"enabled":       info.Enabled(),
+		"mode":          info.Mode,
+		"primary":       info.Primary,
+		"force_promote": false,
+		"global_id":     info.GlobalID,
+		"state":         info.State,
+	}
+	if len(blocks) > 0 && blocks[0] != nil {
+		old := blocks[0].(map[string]interface{})
+		block["force_promote"] = old["force_promote"]
+		if !info.Enabled() {
+			block["mode"] = old["mode"]
+			block["primary"] = old["primary"]
+		}
+	}
+	return []interface{}{block}
+}
+
+// updateVolumeMirroring enables or disables mirroring of the volume and
+// promotes or demotes it as the mirroring block says
+func updateVolumeMirroring(volume sdk.CephVolumeI, volumePath string, d *schema.ResourceData) error {
+	blocks := d.Get("mirroring").([]interface{})
+	if len(blocks) == 0 || blocks[0] == nil {
+		return nil
+	}
+	block := blocks[0].(map[string]interface{})
+	info, err := volume.GetMirrorInfo()
+	if err != nil {
+		return fmt.Errorf("%s get mirroring failed: %v", volumePath, err)
+	}
+
+	if !block["enabled"].(bool) {
+		if info.State == sdk.MirrorImageDisabled {
+			return nil
+		}
+		log.Infof("disable mirroring of volume '%s' ...", volumePath)
+		if err = volume.DisableMirroring(false); err != nil {
+			return fmt.Errorf("disable mirroring of volume '%s' failed: %v", volumePath, err)
+		}
+		return nil
+	}
+
+	mode := block["mode"].(string)
+	if !info.Enabled() {
+		if mode == sdk.MirrorImageModeJournal {
+			features, err := volume.GetFeatures()
+			if err != nil {
+				return fmt.Errorf("%s get features failed: %v", volumePath, err)
+			} else if features&sdk.FeatureJournaling == 0 {
+				return fmt.Errorf("journal mirroring of volume '%s' requires the %s feature", volumePath, sdk.FeatureNameJournaling)
+			}
+		}
+		log.Infof("enable %s mirroring of volume '%s' ...", mode, volumePath)
+		if err = volume.EnableMirroring(mode); err != nil {
+			return fmt.Errorf("enable %s mirroring of volume '%s' failed: %v", mode, volumePath, err)
+		}
+		info.Mode, info.Primary = mode, true
+	} else if info.Mode != mode {
+		return fmt.Errorf("mirroring mode of volume '%s' can't change from %s to %s in place, disable mirroring first", volumePath, info.Mode, mode)
+	}
+
+	if primary := block["primary"].(bool); primary && !info.Primary {
+		log.Infof("promote volume '%s' ...", volumePath)
+		if err = volume.PromoteMirrorImage(block["force_promote"].(bool)); err != nil {
+			return fmt.Errorf("promote volume '%s' failed: %v", volumePath, err)
+		}
+	} else if !primary && info.Primary {
+		log.Infof("demote volume '%s' ...", volumePath)
+		if err = volume.DemoteMirrorImage(); err != nil {
+			return fmt.Errorf("demote volume '%s' failed: %v", volumePath, err)
+		}
+	}
+	return nil
+}
+
+// resourceCephVolumeValidateFeatures refuses feature changes ceph can't do
+// in place, instead of replacing the volume and losing its data
+func resourceCephVolumeValidateFeatures(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if !d.NewValueKnown("features") {
+		return nil
+	}
+	features, ok := d.GetOk("features")
+	if !ok {
+		return nil
+	}
+	if d.Id() == "" {
+		if base, ok := d.GetOk("base_snapshot"); ok && base.(string) != "" && d.Get("clone_mode").(string) != cloneModeDeepCopy &&
+			!features.(*schema.Set).Contains(sdk.FeatureNameLayering) {
+			return fmt.Errorf("features of a clone must contain %s", sdk.FeatureNameLayering)
+		}
+		return nil
+	}
+	if !d.HasChange("features") {
+		return nil
+	}
+	o, n := d.GetChange("features")
+	old, new := o.(*schema.Set), n.(*schema.Set)
+	if old.Contains(sdk.FeatureNameLayering) != new.Contains(sdk.FeatureNameLayering) {
+		return fmt.Errorf("feature %s of volume '%s' can't be changed", sdk.FeatureNameLayering, d.Id())
+	}
+	if !old.Contains(sdk.FeatureNameDeepFlatten) && new.Contains(sdk.FeatureNameDeepFlatten) {
+		return fmt.Errorf("feature %s of volume '%s' can only be disabled", sdk.FeatureNameDeepFlatten, d.Id())
+	}
+	return nil
+}
+
+// resourceCephVolumeValidateCloneMode refuses to turn an independent volume
+// into a clone and to deep copy an existing volume, which would only be
+// flattened, changes to clone_and_flatten flatten the volume in place
+func resourceCephVolumeValidateCloneMode(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || !d.HasChange("clone_mode") {
+		return nil
+	}
+	if o, n := d.GetChange("clone_mode"); o.(string) != "" && (n.(string) == cloneModeClone || n.(string) == cloneModeDeepCopy) {
+		return fmt.Errorf("clone_mode of volume '%s' can't be changed from %s to %s", d.Id(), o, n)
+	}
+	return nil
+}
+
+// resourceCephVolumeValidateSize refuses to shrink volumes unless allow_shrink
+// is set, so that the plan fails rather than the apply
+func resourceCephVolumeValidateSize(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || !d.HasChange("size") || d.Get("allow_shrink").(bool) {
+		return nil
+	}
+	if o, n := d.GetChange("size"); n.(int) > 0 && n.(int) < o.(int) {
+		return fmt.Errorf("volume '%s' can't shrink from %d to %d bytes unless `allow_shrink` is set", d.Id(), o, n)
+	}
+	return nil
+}
+
+// validateObjectSize accepts powers of two from 4K to 32M
+func validateObjectSize(i interface{}, k string) (warnings []string, errors []error) {
+	v, ok := i.(int)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be integer", k)}
+	}
+	if v < 4<<10 || v > 32<<20 || v&(v-1) != 0 {
+		return nil, []error{fmt.Errorf("expected %s to be a power of two between 4096 and 33554432, got %d", k, v)}
+	}
+	return nil, nil
+}
+
+// validateMetadata refuses empty keys and the keys of config overrides, which
+// aren't metadata of the user
+func validateMetadata(i interface{}, k string) (warnings []string, errors []error) {
+	v, ok := i.(map[string]interface{})
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be map", k)}
+	}
+	for key := range v {
+		if key == "" {
+			errors = append(errors, fmt.Errorf("expected %s not to contain empty keys", k))
+		} else if strings.HasPrefix(key, sdk.ConfMetadataPrefix) {
+			errors = append(errors, fmt.Errorf("expected %s not to contain config overrides, got %q", k, key))
+		}
+	}
+	return nil, errors
+}
+
+// validateDuration accepts durations of time.ParseDuration which aren't negative
+func validateDuration(i interface{}, k string) (warnings []string, errors []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if duration, err := time.ParseDuration(v); err != nil {
+		return nil, []error{fmt.Errorf("expected %s to be a duration like 24h, got %q: %v", k, v, err)}
+	} else if duration < 0 {
+		return nil, []error{fmt.Errorf("expected %s not to be negative, got %q", k, v)}
+	}
+	return nil, nil
+}
+
 // resourceCephVolumeDelete removed a volume resource
 func resourceCephVolumeDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
 	log.Debugf("delete resource ceph_volume")
-	cluster, poolName, volumeName, _, _ := sdk.ParseCephVol(d.Id())
-	client, err := getClient(cluster, meta)
+	cluster, poolName, namespace, volumeName, _, err := sdk.ParseCephVol(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	client, err := getClient(ctx, cluster, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	client.MutexKV.Lock(volumeName)
-	defer client.MutexKV.Unlock(volumeName)
+	if err = client.GetMutexKV().LockContext(ctx, d.Id()); err != nil {
+		return diag.FromErr(err)
+	}
+	defer client.GetMutexKV().Unlock(d.Id())
+
+	switch d.Get("deletion_policy").(string) {
+	case deletionPolicyRetain:
+		log.Warnf("volume '%s' is retained in ceph, deletion_policy is %s", d.Id(), deletionPolicyRetain)
+		return nil
+	case deletionPolicyTrash:
+		delay, err := time.ParseDuration(d.Get("trash_delay").(string))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		log.Infof("move volume '%s' to trash, it can't be purged for %s ...", d.Id(), delay)
+		if err = client.TrashVol(poolName, namespace, volumeName, delay); err != nil {
+			return diag.Errorf("move volume '%s' to trash failed: %v", d.Id(), err)
+		}
+		return nil
+	}
+
+	volume, err := client.LookupVolByName(poolName, namespace, volumeName)
+	if err != nil {
+		return diag.FromErr(err)
+	} else if volume == nil {
+		return nil
+	}
+	children, err := volume.ListChildren()
+	volume.Close()
+	if err != nil {
+		return diag.Errorf("list clones of volume '%s' failed: %v", d.Id(), err)
+	}
+	if err = flattenChildren(ctx, d, client, d.Id(), children); err != nil {
+		return diag.FromErr(err)
+	}
 
 	log.Infof("delete volume '%s' ...", d.Id())
-	return diag.FromErr(client.DeleteVol(poolName, volumeName))
+	return diag.FromErr(client.DeleteVol(poolName, namespace, volumeName))
+}
+
+// flattenChildren flattens the clones of a volume or snapshot to be deleted
+// if force_flatten_children is set, it fails naming the clones otherwise
+func flattenChildren(ctx context.Context, d *schema.ResourceData, client sdk.CephClientI, parentID string, children []string) error {
+	if len(children) == 0 {
+		return nil
+	} else if !d.Get("force_flatten_children").(bool) {
+		return fmt.Errorf("%v, flatten or delete them first or set force_flatten_children",
+			&sdk.ChildrenError{Parent: parentID, Children: children})
+	}
+
+	for _, child := range children {
+		_, poolName, namespace, volumeName, _, err := sdk.ParseCephVol(child)
+		if err != nil {
+			return err
+		}
+		volume, err := client.LookupVolByName(poolName, namespace, volumeName)
+		if err != nil {
+			return err
+		} else if volume == nil {
+			return fmt.Errorf("clone '%s' of '%s' not found, it may be in the trash", child, parentID)
+		}
+		log.Infof("flatten clone '%s' of '%s' ...", child, parentID)
+		err = volume.Flatten(ctx)
+		volume.Close()
+		if err != nil {
+			return fmt.Errorf("flatten clone '%s' of '%s' failed: %v", child, parentID, err)
+		}
+	}
+	return nil
 }
 
 //// resourceCephVolumeExists returns True if the volume resource exists
@@ -0,0 +1,1035 @@
+package ceph
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestCephVolume_Basic(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "vol1",
+		"size":    1073741824,
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	if state.ID != "ceph/pool1/vol1" {
+		t.Fatalf("expect id ceph/pool1/vol1, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "size", "1073741824")
+	testCheckAttr(t, state, "base_snapshot", "")
+
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	if vol, _ := client.LookupVolByName("pool1", "", "vol1"); vol != nil {
+		t.Fatal("vol1 not deleted")
+	}
+}
+
+func TestCephVolume_MissingSize(t *testing.T) {
+	meta := testMeta("ceph")
+	_ = testFakeClient(t, meta, "ceph").CreatePool("pool1", nil)
+
+	_, err := testApply(resourceCephVolume(), nil, map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "vol1",
+	}, meta)
+	if err == nil {
+		t.Fatal("expect error without size and base_snapshot")
+	}
+}
+
+func TestCephVolume_CloneAndFlatten(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	base, _ := client.CreateVol("pool1", "", "base", 1024, nil)
+	snap, _ := base.CreateSnapshot("snap1")
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"name":          "vol1",
+		"base_snapshot": "ceph/pool1/base@snap1",
+	}
+
+	if _, err := testApply(r, nil, config, meta); err == nil {
+		t.Fatal("expect error cloning from an unprotected snapshot")
+	}
+
+	_ = snap.Protect()
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "base_snapshot", "ceph/pool1/base@snap1")
+	testCheckAttr(t, state, "size", "1024")
+	if err := snap.Unprotect(); err == nil {
+		t.Fatal("expect unprotect to fail while the snapshot has a child")
+	}
+
+	// removing base_snapshot flattens the clone in place
+	delete(config, "base_snapshot")
+	state = testMustApply(t, r, state, config, meta)
+	if state.ID != "ceph/pool1/vol1" {
+		t.Fatalf("expect volume updated in place, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "base_snapshot", "")
+	if err := snap.Unprotect(); err != nil {
+		t.Fatalf("expect unprotect to succeed after flatten: %v", err)
+	}
+}
+
+func TestCephVolume_CloneMode(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	base, _ := client.CreateVol("pool1", "", "base", 1<<20, nil)
+	_, _ = base.WriteAt([]byte("template"), 0)
+	_, _ = base.CreateSnapshot("snap0")
+	snap, _ := base.CreateSnapshot("snap1")
+	_, _ = base.CreateSnapshot("snap2")
+	r := resourceCephVolume()
+
+	// deep copies need no protected snapshot and bring the snapshots along
+	deepConfig := map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"name":          "deep",
+		"base_snapshot": "ceph/pool1/base@snap1",
+		"clone_mode":    "deep_copy",
+		"features":      []interface{}{"exclusive-lock"},
+	}
+	state := testMustApply(t, r, nil, deepConfig, meta)
+	testCheckAttr(t, state, "base_snapshot", "ceph/pool1/base@snap1")
+	testCheckAttr(t, state, "size", "1048576")
+	if diff := testPlan(t, r, state, deepConfig, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after deep copy, got %#v", diff)
+	}
+	deep, _ := client.LookupVolByName("pool1", "", "deep")
+	for name, expect := range map[string]bool{"snap0": true, "snap1": true, "snap2": false} {
+		if s, _ := deep.LookupSnapByName(name); (s != nil) != expect {
+			t.Fatalf("expect snapshot %s copied: %v", name, expect)
+		}
+	}
+	buf := make([]byte, 8)
+	if _, _ = deep.ReadAt(buf, 0); string(buf) != "template" {
+		t.Fatalf("expect data to be copied, got %q", buf)
+	}
+
+	_ = snap.Protect()
+	flattenConfig := map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"name":          "flat",
+		"base_snapshot": "ceph/pool1/base@snap1",
+		"clone_mode":    "clone_and_flatten",
+	}
+	state = testMustApply(t, r, nil, flattenConfig, meta)
+	testCheckAttr(t, state, "base_snapshot", "ceph/pool1/base@snap1")
+	if diff := testPlan(t, r, state, flattenConfig, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after clone and flatten, got %#v", diff)
+	}
+
+	// a clone is flattened in place when clone_mode changes
+	cloneConfig := map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"name":          "clone",
+		"base_snapshot": "ceph/pool1/base@snap1",
+	}
+	state = testMustApply(t, r, nil, cloneConfig, meta)
+	testCheckAttr(t, state, "clone_mode", "clone")
+	if err := snap.Unprotect(); err == nil {
+		t.Fatal("expect unprotect to fail while the snapshot has a child")
+	}
+	cloneConfig["clone_mode"] = "clone_and_flatten"
+	state = testMustApply(t, r, state, cloneConfig, meta)
+	testCheckAttr(t, state, "base_snapshot", "ceph/pool1/base@snap1")
+	if err := snap.Unprotect(); err != nil {
+		t.Fatalf("expect no children after flatten: %v", err)
+	}
+
+	cloneConfig["clone_mode"] = "clone"
+	if _, err := testApply(r, state, cloneConfig, meta); err == nil {
+		t.Fatal("expect error turning a flattened volume into a clone")
+	}
+	cloneConfig["clone_mode"] = "deep_copy"
+	if _, err := testApply(r, state, cloneConfig, meta); err == nil || !strings.Contains(err.Error(), "can't be changed") {
+		t.Fatalf("expect error deep copying an existing volume, got %v", err)
+	}
+}
+
+func TestCephVolume_CloneFromDifferentCluster(t *testing.T) {
+	meta := testMeta("ceph", "dr")
+
+	_, err := testApply(resourceCephVolume(), nil, map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"name":          "vol1",
+		"base_snapshot": "dr/pool1/base@snap1",
+	}, meta)
+	if err == nil {
+		t.Fatal("expect error cloning from another cluster")
+	}
+}
+
+func TestCephVolume_CopyFromDifferentCluster(t *testing.T) {
+	meta := testMeta("build", "edge")
+	build := testFakeClient(t, meta, "build")
+	_ = build.CreatePool("images", nil)
+	_ = testFakeClient(t, meta, "edge").CreatePool("pool1", nil)
+	base, _ := build.CreateVol("images", "", "golden", 16<<20, nil)
+	_, _ = base.WriteAt([]byte("boot sector"), 0)
+	_, _ = base.WriteAt([]byte("root fs"), 8<<20)
+	_, _ = base.CreateSnapshot("v1")
+	_, _ = base.WriteAt([]byte("written after v1"), 12<<20)
+
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id":   "edge/pool1",
+		"name":      "vol1",
+		"copy_from": "build/images/golden@v1",
+	}
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "size", "16777216")
+	testCheckAttr(t, state, "base_snapshot", "")
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after copy, got %#v", diff)
+	}
+
+	vol, _ := testFakeClient(t, meta, "edge").LookupVolByName("pool1", "", "vol1")
+	buf := make([]byte, 16)
+	for offset, expect := range map[int64]string{0: "boot sector", 8 << 20: "root fs", 12 << 20: ""} {
+		_, _ = vol.ReadAt(buf, offset)
+		if got := string(bytes.TrimRight(buf, "\x00")); got != expect {
+			t.Fatalf("expect %q at %d, got %q", expect, offset, got)
+		}
+	}
+	extents, _ := vol.GetAllocatedExtents()
+	if len(extents) != 2 || extents[0].Offset != 0 || extents[1].Offset != 8<<20 {
+		t.Fatalf("expect only the written chunks to be copied, got %v", extents)
+	}
+
+	for _, copyFrom := range []string{"build/images/golden@v2", "build/images/golden", "dr/images/golden@v1"} {
+		config["name"], config["copy_from"] = "vol2", copyFrom
+		if _, err := testApply(r, nil, config, meta); err == nil {
+			t.Fatalf("expect error copying from '%s'", copyFrom)
+		}
+	}
+}
+
+func TestCephVolume_Rollback(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "vol1",
+		"size":    1024,
+	}
+	state := testMustApply(t, r, nil, config, meta)
+
+	config["rollback_snapshot_name"] = "snap1"
+	if _, err := testApply(r, state, config, meta); err == nil {
+		t.Fatal("expect error rolling back to a missing snapshot")
+	}
+
+	vol, _ := client.LookupVolByName("pool1", "", "vol1")
+	_, _ = vol.CreateSnapshot("snap1")
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "rollback_snapshot_name", "snap1")
+}
+
+func TestCephVolume_Timeouts(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	client.OpDelay = 100 * time.Millisecond
+	_ = client.CreatePool("pool1", nil)
+	base, _ := client.CreateVol("pool1", "", "base", 1024, nil)
+	snap, _ := base.CreateSnapshot("snap1")
+	_ = snap.Protect()
+	r := resourceCephVolume()
+	timeouts := []interface{}{map[string]interface{}{"create": "10ms", "update": "10ms"}}
+
+	_, err := testApply(r, nil, map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"name":          "deep",
+		"base_snapshot": "ceph/pool1/base@snap1",
+		"clone_mode":    "deep_copy",
+		"timeouts":      timeouts,
+	}, meta)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("expect deep copy to be aborted, got %v", err)
+	}
+	if vol, _ := client.LookupVolByName("pool1", "", "deep"); vol != nil {
+		t.Fatal("expect no partial deep copy")
+	}
+
+	// an aborted flatten leaves the clone in the state to be replaced
+	state, err := testApply(r, nil, map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"name":          "flat",
+		"base_snapshot": "ceph/pool1/base@snap1",
+		"clone_mode":    "clone_and_flatten",
+		"timeouts":      timeouts,
+	}, meta)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("expect flatten to be aborted, got %v", err)
+	}
+	if state == nil || state.ID != "ceph/pool1/flat" {
+		t.Fatalf("expect the clone in the state, got %v", state)
+	}
+
+	config := map[string]interface{}{
+		"pool_id":                "ceph/pool1",
+		"name":                   "vol1",
+		"size":                   1024,
+		"rollback_snapshot_name": "",
+		"timeouts":               timeouts,
+	}
+	state = testMustApply(t, r, nil, config, meta)
+	vol, _ := client.LookupVolByName("pool1", "", "vol1")
+	_, _ = vol.CreateSnapshot("snap1")
+	config["rollback_snapshot_name"] = "snap1"
+	if _, err = testApply(r, state, config, meta); err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("expect rollback to be aborted, got %v", err)
+	}
+
+	config["timeouts"] = []interface{}{map[string]interface{}{"update": "1m"}}
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "rollback_snapshot_name", "snap1")
+}
+
+func TestCephVolume_LockTimeout(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id":  "ceph/pool1",
+		"name":     "vol1",
+		"size":     1024,
+		"timeouts": []interface{}{map[string]interface{}{"create": "10ms"}},
+	}
+
+	// a snapshot of the volume holds the lock
+	client.GetMutexKV().Lock("ceph/pool1/vol1")
+	if _, err := testApply(r, nil, config, meta); err == nil || !strings.Contains(err.Error(), "wait for lock") {
+		t.Fatalf("expect to give up waiting for the lock, got %v", err)
+	}
+	client.GetMutexKV().Unlock("ceph/pool1/vol1")
+
+	// volumes of the same name in other namespaces don't share the lock
+	client.GetMutexKV().Lock("ceph/pool1/ns1/vol1")
+	defer client.GetMutexKV().Unlock("ceph/pool1/ns1/vol1")
+	testMustApply(t, r, nil, config, meta)
+}
+
+func TestCephVolume_DeletionPolicy(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id":            "ceph/pool1",
+		"name":               "vol1",
+		"size":               1 << 20,
+		"deletion_policy":    "trash",
+		"trash_delay":        "168h",
+		"restore_from_trash": true,
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	vol, _ := client.LookupVolByName("pool1", "", "vol1")
+	_, _ = vol.WriteAt([]byte("precious"), 0)
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	if vol, _ = client.LookupVolByName("pool1", "", "vol1"); vol != nil {
+		t.Fatal("expect volume moved to the trash")
+	}
+	entries, _ := client.ListTrash("pool1", "")
+	if len(entries) != 1 || entries[0].Name != "vol1" || entries[0].DeferredUntil.Sub(entries[0].DeletionTime) != 168*time.Hour {
+		t.Fatalf("expect one trash entry deferred by 168h, got %v", entries)
+	}
+
+	// the next create brings the data back
+	state = testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "size", "1048576")
+	vol, _ = client.LookupVolByName("pool1", "", "vol1")
+	buf := make([]byte, 8)
+	if _, _ = vol.ReadAt(buf, 0); string(buf) != "precious" {
+		t.Fatalf("expect the data to be restored, got %q", buf)
+	}
+	if entries, _ = client.ListTrash("pool1", ""); len(entries) != 0 {
+		t.Fatalf("expect empty trash after restore, got %v", entries)
+	}
+
+	config["deletion_policy"] = "retain"
+	state = testMustApply(t, r, state, config, meta)
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	if vol, _ = client.LookupVolByName("pool1", "", "vol1"); vol == nil {
+		t.Fatal("expect volume retained in ceph")
+	}
+
+	config["deletion_policy"] = "delete"
+	state = testMustApply(t, r, nil, config, meta)
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+	if vol, _ = client.LookupVolByName("pool1", "", "vol1"); vol != nil {
+		t.Fatal("expect volume deleted")
+	}
+	if entries, _ = client.ListTrash("pool1", ""); len(entries) != 0 {
+		t.Fatalf("expect nothing in the trash, got %v", entries)
+	}
+
+	config["trash_delay"] = "-1h"
+	if _, err := testApply(r, nil, config, meta); err == nil {
+		t.Fatal("expect error with a negative trash_delay")
+	}
+}
+
+func TestCephVolume_DeleteWithChildren(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "template",
+		"size":    1024,
+	}
+	state := testMustApply(t, r, nil, config, meta)
+	vol, _ := client.LookupVolByName("pool1", "", "template")
+	snap, _ := vol.CreateSnapshot("v1")
+	_ = snap.Protect()
+	_, _ = client.CloneImg("pool1", "", "template", "v1", "pool1", "", "vm1", nil)
+
+	if err := testDestroy(r, state, meta); err == nil || !strings.Contains(err.Error(), "has clone children: ceph/pool1/vm1") {
+		t.Fatalf("expect destroy to fail naming the clone, got %v", err)
+	}
+
+	// the clone is flattened, the snapshot still blocks the delete
+	config["force_flatten_children"] = true
+	state = testMustApply(t, r, state, config, meta)
+	if err := testDestroy(r, state, meta); err == nil {
+		t.Fatal("expect destroy to fail while the volume has snapshots")
+	}
+	clone, _ := client.LookupVolByName("pool1", "", "vm1")
+	if parent, _ := clone.GetParent(); parent != "" {
+		t.Fatalf("expect clone to be flattened, parent is %s", parent)
+	}
+	_ = snap.Remove()
+	if err := testDestroy(r, state, meta); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCephVolume_Lineage(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_ = client.CreatePool("pool2", nil)
+	vol, _ := client.CreateVol("pool1", "", "template", 4096, nil)
+	snap, _ := vol.CreateSnapshot("v1")
+	_ = snap.Protect()
+	r := resourceCephVolume()
+
+	state := testMustApply(t, r, nil, map[string]interface{}{
+		"pool_id":       "ceph/pool2",
+		"name":          "vm1",
+		"base_snapshot": "ceph/pool1/template@v1",
+	}, meta)
+	testCheckAttr(t, state, "parent_pool", "pool1")
+	testCheckAttr(t, state, "parent_namespace", "")
+	testCheckAttr(t, state, "parent_image", "template")
+	testCheckAttr(t, state, "parent_snapshot", "v1")
+	testCheckAttr(t, state, "overlap", "4096")
+	testCheckAttr(t, state, "clone_depth", "1")
+	testCheckAttr(t, state, "children.#", "0")
+
+	clone, _ := client.LookupVolByName("pool2", "", "vm1")
+	cloneSnap, _ := clone.CreateSnapshot("s1")
+	_ = cloneSnap.Protect()
+	_, _ = client.CloneImg("pool2", "", "vm1", "s1", "pool1", "", "vm2", nil)
+	_ = clone.Resize(1024)
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "overlap", "1024")
+	testCheckAttr(t, state, "children.#", "1")
+	testCheckAttr(t, state, "children.0", "ceph/pool1/vm2")
+
+	state, err := testImport(r, "ceph/pool1/vm2", meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckAttr(t, state, "parent_image", "vm1")
+	testCheckAttr(t, state, "clone_depth", "2")
+
+	vm2, _ := client.LookupVolByName("pool1", "", "vm2")
+	_ = vm2.Flatten(context.Background())
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "parent_pool", "")
+	testCheckAttr(t, state, "overlap", "0")
+	testCheckAttr(t, state, "clone_depth", "0")
+}
+
+func TestCephVolume_DeletedOutside(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+
+	state := testMustApply(t, r, nil, map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "vol1",
+		"size":    1024,
+	}, meta)
+	_ = client.DeleteVol("pool1", "", "vol1")
+
+	if state = testRefresh(t, r, state, meta); state != nil {
+		t.Fatalf("expect volume removed from state, got %s", state.ID)
+	}
+}
+
+func TestCephVolume_Resize(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "vol1",
+		"size":    1024,
+	}
+	state := testMustApply(t, r, nil, config, meta)
+
+	config["size"] = 4096
+	state = testMustApply(t, r, state, config, meta)
+	if state.ID != "ceph/pool1/vol1" {
+		t.Fatalf("expect volume grown in place, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "size", "4096")
+
+	config["size"] = 2048
+	if _, err := r.Diff(context.Background(), state, terraform.NewResourceConfigRaw(config), meta); err == nil || !strings.Contains(err.Error(), "allow_shrink") {
+		t.Fatalf("expect plan of shrink to fail without allow_shrink, got %v", err)
+	}
+	if _, err := testApply(r, state, config, meta); err == nil {
+		t.Fatal("expect shrink to fail without allow_shrink")
+	}
+	vol, _ := client.LookupVolByName("pool1", "", "vol1")
+	if size, _ := vol.GetSize(); size != 4096 {
+		t.Fatalf("expect size untouched after refused shrink, got %d", size)
+	}
+
+	config["allow_shrink"] = true
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "size", "2048")
+}
+
+func TestCephVolume_ResizeExisting(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_, _ = client.CreateVol("pool1", "", "vol1", 1024, nil)
+
+	state := testMustApply(t, resourceCephVolume(), nil, map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "vol1",
+		"size":    4096,
+	}, meta)
+	testCheckAttr(t, state, "size", "4096")
+}
+
+func TestCephVolume_DataPool(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_ = client.CreatePool("ecpool", &sdk.PoolConfig{PoolType: "erasure"})
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id":   "ceph/pool1",
+		"name":      "vol1",
+		"size":      1024,
+		"data_pool": "ecpool",
+	}
+
+	if _, err := testApply(r, nil, config, meta); err == nil {
+		t.Fatal("expect error using an erasure pool without allow_ec_overwrites")
+	}
+
+	_ = client.SetPoolOption("ecpool", "allow_ec_overwrites", "true")
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "data_pool", "ecpool")
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	delete(config, "data_pool")
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect data_pool to be kept when unset, got %#v", diff)
+	}
+	config["data_pool"] = "pool1"
+	if diff := testPlan(t, r, state, config, meta); !diff.RequiresNew() {
+		t.Fatal("expect volume to be replaced when data_pool changes")
+	}
+}
+
+func TestCephVolume_Metadata(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "vol1",
+		"size":    1024,
+		"metadata": map[string]interface{}{
+			"owner":   "team-a",
+			"vm_uuid": "0b5f1b2e",
+		},
+	}
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "metadata.%", "2")
+	testCheckAttr(t, state, "metadata.owner", "team-a")
+
+	// changes outside terraform are drift, config overrides aren't
+	vol, _ := client.LookupVolByName("pool1", "", "vol1")
+	_ = vol.SetMetadata("backup", "daily")
+	_ = vol.SetMetadata("conf_rbd_cache", "false")
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "metadata.%", "3")
+	if diff := testPlan(t, r, state, config, meta); diff.Empty() {
+		t.Fatal("expect metadata drift to be planned")
+	}
+
+	config["metadata"] = map[string]interface{}{"owner": "team-b"}
+	state = testMustApply(t, r, state, config, meta)
+	metadata, _ := vol.ListMetadata()
+	if len(metadata) != 2 || metadata["owner"] != "team-b" || metadata["conf_rbd_cache"] != "false" {
+		t.Fatalf("expect owner updated and the config override kept, got %v", metadata)
+	}
+
+	config["metadata"] = map[string]interface{}{"conf_rbd_qos_bps_limit": "100"}
+	if _, err := testApply(r, state, config, meta); err == nil || !strings.Contains(err.Error(), "config overrides") {
+		t.Fatalf("expect config overrides to be refused, got %v", err)
+	}
+}
+
+func TestCephVolume_CloneMetadata(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	vol, _ := client.CreateVol("pool1", "", "template", 1024, nil)
+	_ = vol.SetMetadata("os", "ubuntu")
+	_ = vol.SetMetadata("owner", "images")
+	snap, _ := vol.CreateSnapshot("v1")
+	_ = snap.Protect()
+	r := resourceCephVolume()
+
+	// clones inherit the metadata of the parent, keys missing in the config are removed
+	state := testMustApply(t, r, nil, map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"name":          "vm1",
+		"base_snapshot": "ceph/pool1/template@v1",
+		"metadata":      map[string]interface{}{"owner": "team-a"},
+	}, meta)
+	testCheckAttr(t, state, "metadata.%", "1")
+	testCheckAttr(t, state, "metadata.owner", "team-a")
+
+	// unset metadata keeps the inherited keys
+	config := map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"name":          "vm2",
+		"base_snapshot": "ceph/pool1/template@v1",
+	}
+	state = testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "metadata.%", "2")
+	testCheckAttr(t, state, "metadata.os", "ubuntu")
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+	clone, _ := client.LookupVolByName("pool1", "", "vm2")
+	if metadata, _ := clone.ListMetadata(); len(metadata) != 2 {
+		t.Fatalf("expect inherited metadata kept, got %v", metadata)
+	}
+}
+
+func TestCephVolume_Qos(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id":  "ceph/pool1",
+		"name":     "vol1",
+		"size":     1024,
+		"metadata": map[string]interface{}{"owner": "team-a"},
+		"qos": map[string]interface{}{
+			"iops_limit": 500,
+			"iops_burst": 1000,
+		},
+	}
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "qos.iops_limit", "500")
+	testCheckAttr(t, state, "qos.iops_burst", "1000")
+	testCheckAttr(t, state, "metadata.%", "1")
+	vol, _ := client.LookupVolByName("pool1", "", "vol1")
+	metadata, _ := vol.ListMetadata()
+	if metadata["conf_rbd_qos_iops_limit"] != "500" || metadata["conf_rbd_qos_iops_burst"] != "1000" {
+		t.Fatalf("expect qos config overrides of the image, got %v", metadata)
+	}
+
+	_ = vol.SetMetadata("conf_rbd_qos_iops_limit", "5000")
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "qos.iops_limit", "5000")
+	if diff := testPlan(t, r, state, config, meta); diff.Empty() {
+		t.Fatal("expect qos drift to be planned")
+	}
+
+	config["qos"] = map[string]interface{}{"write_bps_limit": 1048576}
+	state = testMustApply(t, r, state, config, meta)
+	metadata, _ = vol.ListMetadata()
+	if len(metadata) != 2 || metadata["conf_rbd_qos_write_bps_limit"] != "1048576" || metadata["owner"] != "team-a" {
+		t.Fatalf("expect only write_bps_limit and the metadata left, got %v", metadata)
+	}
+}
+
+func TestCephVolume_QosOverridesPool(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	pool := resourceCephPool()
+	_ = testMustApply(t, pool, nil, map[string]interface{}{
+		"name":                "pool1",
+		"deletion_protection": false,
+		"qos":                 map[string]interface{}{"iops_limit": 1000, "bps_limit": 104857600},
+	}, meta)
+	r := resourceCephVolume()
+
+	// 0 lifts the limit of the pool, unset options inherit it
+	config := map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "vol1",
+		"size":    1024,
+		"qos":     map[string]interface{}{"iops_limit": 0},
+	}
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "qos.%", "1")
+	testCheckAttr(t, state, "qos.iops_limit", "0")
+	vol, _ := client.LookupVolByName("pool1", "", "vol1")
+	metadata, _ := vol.ListMetadata()
+	if len(metadata) != 1 || metadata["conf_rbd_qos_iops_limit"] != "0" {
+		t.Fatalf("expect an override of iops_limit with 0, got %v", metadata)
+	}
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	// removing the option inherits the limit of the pool again
+	config["qos"] = map[string]interface{}{}
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "qos.%", "0")
+	if metadata, _ = vol.ListMetadata(); len(metadata) != 0 {
+		t.Fatalf("expect the override removed, got %v", metadata)
+	}
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+}
+
+func TestCephVolume_CloneQos(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	vol, _ := client.CreateVol("pool1", "", "template", 1024, nil)
+	_ = vol.SetMetadata("conf_rbd_qos_iops_limit", "500")
+	snap, _ := vol.CreateSnapshot("v1")
+	_ = snap.Protect()
+	r := resourceCephVolume()
+
+	// clones inherit the limits of the parent, which are kept without qos
+	config := map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"name":          "vm1",
+		"base_snapshot": "ceph/pool1/template@v1",
+	}
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "qos.iops_limit", "500")
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	config["qos"] = map[string]interface{}{}
+	state = testMustApply(t, r, state, config, meta)
+	clone, _ := client.LookupVolByName("pool1", "", "vm1")
+	if metadata, _ := clone.ListMetadata(); len(metadata) != 0 {
+		t.Fatalf("expect inherited limits removed by an empty qos, got %v", metadata)
+	}
+}
+
+func TestCephVolume_Mirroring(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_ = client.SetMirrorMode("pool1", sdk.MirrorModeImage)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id":   "ceph/pool1",
+		"name":      "vol1",
+		"size":      1024,
+		"mirroring": []interface{}{map[string]interface{}{}},
+	}
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "mirroring.0.enabled", "true")
+	testCheckAttr(t, state, "mirroring.0.mode", "snapshot")
+	testCheckAttr(t, state, "mirroring.0.primary", "true")
+	testCheckAttr(t, state, "mirroring.0.state", "enabled")
+	if state.Attributes["mirroring.0.global_id"] == "" {
+		t.Fatal("expect a global id of the mirrored image")
+	}
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	config["mirroring"] = []interface{}{map[string]interface{}{"primary": false}}
+	state = testMustApply(t, r, state, config, meta)
+	vol, _ := client.LookupVolByName("pool1", "", "vol1")
+	if info, _ := vol.GetMirrorInfo(); info.Primary {
+		t.Fatal("expect volume to be demoted")
+	}
+	config["mirroring"] = []interface{}{map[string]interface{}{"primary": true, "force_promote": true}}
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "mirroring.0.primary", "true")
+
+	config["mirroring"] = []interface{}{map[string]interface{}{"mode": "journal"}}
+	if _, err := testApply(r, state, config, meta); err == nil || !strings.Contains(err.Error(), "can't change from snapshot to journal") {
+		t.Fatalf("expect mode change to be refused, got %v", err)
+	}
+
+	config["mirroring"] = []interface{}{map[string]interface{}{"enabled": false}}
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "mirroring.0.state", "disabled")
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan with mirroring disabled, got %#v", diff)
+	}
+
+	// journal mode requires journaling
+	config["mirroring"] = []interface{}{map[string]interface{}{"mode": "journal"}}
+	if _, err := testApply(r, state, config, meta); err == nil || !strings.Contains(err.Error(), "requires the journaling feature") {
+		t.Fatalf("expect journal mode to require journaling, got %v", err)
+	}
+	config["features"] = []interface{}{"layering", "exclusive-lock", "journaling"}
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "mirroring.0.mode", "journal")
+}
+
+func TestCephVolume_MirroringUnmanaged(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "vol1",
+		"size":    1024,
+	}
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "mirroring.#", "0")
+
+	// mirroring enabled outside terraform is shown, but not planned away
+	_ = client.SetMirrorMode("pool1", sdk.MirrorModeImage)
+	vol, _ := client.LookupVolByName("pool1", "", "vol1")
+	_ = vol.EnableMirroring(sdk.MirrorImageModeSnapshot)
+	state = testRefresh(t, r, state, meta)
+	testCheckAttr(t, state, "mirroring.0.state", "enabled")
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan without a mirroring block, got %#v", diff)
+	}
+
+	config["mirroring"] = []interface{}{map[string]interface{}{}}
+	_ = client.SetMirrorMode("pool1", sdk.MirrorModePool)
+	_ = vol.DisableMirroring(false)
+	state = testRefresh(t, r, state, meta)
+	if _, err := testApply(r, state, config, meta); err == nil {
+		t.Fatal("expect enabling mirroring to fail in pool mode")
+	}
+}
+
+func TestCephVolume_Features(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id":  "ceph/pool1",
+		"name":     "vol1",
+		"size":     1024,
+		"features": []interface{}{"layering", "exclusive-lock"},
+	}
+	features := func() uint64 {
+		vol, _ := client.LookupVolByName("pool1", "", "vol1")
+		defer vol.Close()
+		ret, _ := vol.GetFeatures()
+		return ret
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "features.#", "2")
+	if f := features(); f != sdk.FeatureLayering|sdk.FeatureExclusiveLock {
+		t.Fatalf("expect layering and exclusive-lock, got %d", f)
+	}
+
+	// fast-diff needs object-map, both are enabled in one apply
+	config["features"] = []interface{}{"layering", "exclusive-lock", "object-map", "fast-diff"}
+	state = testMustApply(t, r, state, config, meta)
+	testCheckAttr(t, state, "features.#", "4")
+	if f := features(); f&sdk.FeatureFastDiff == 0 || f&sdk.FeatureObjectMap == 0 {
+		t.Fatalf("expect object-map and fast-diff enabled, got %d", f)
+	}
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+
+	config["features"] = []interface{}{"layering"}
+	state = testMustApply(t, r, state, config, meta)
+	if f := features(); f != sdk.FeatureLayering {
+		t.Fatalf("expect only layering, got %d", f)
+	}
+
+	config["features"] = []interface{}{"exclusive-lock"}
+	if _, err := testApply(r, state, config, meta); err == nil {
+		t.Fatal("expect error disabling layering")
+	}
+	config["features"] = []interface{}{"layering", "deep-flatten"}
+	if _, err := testApply(r, state, config, meta); err == nil {
+		t.Fatal("expect error enabling deep-flatten")
+	}
+	config["features"] = []interface{}{"layering", "object-map"}
+	if _, err := testApply(r, state, config, meta); err == nil {
+		t.Fatal("expect error enabling object-map without exclusive-lock")
+	}
+}
+
+func TestCephVolume_DefaultFeatures(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+
+	state := testMustApply(t, r, nil, map[string]interface{}{
+		"pool_id": "ceph/pool1",
+		"name":    "vol1",
+		"size":    1024,
+	}, meta)
+	testCheckAttr(t, state, "features.#", "5")
+	testCheckAttr(t, state, "object_size", "4194304")
+	testCheckAttr(t, state, "stripe_unit", "4194304")
+	testCheckAttr(t, state, "stripe_count", "1")
+
+	vol, _ := client.LookupVolByName("pool1", "", "vol1")
+	snap, _ := vol.CreateSnapshot("snap1")
+	_ = snap.Protect()
+	vol.Close()
+	config := map[string]interface{}{
+		"pool_id":       "ceph/pool1",
+		"name":          "vol2",
+		"base_snapshot": "ceph/pool1/vol1@snap1",
+		"features":      []interface{}{"exclusive-lock"},
+	}
+	if _, err := testApply(r, nil, config, meta); err == nil {
+		t.Fatal("expect error cloning without layering")
+	}
+	config["features"] = []interface{}{"layering", "exclusive-lock"}
+	state = testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "features.#", "2")
+}
+
+func TestCephVolume_Striping(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	r := resourceCephVolume()
+	config := map[string]interface{}{
+		"pool_id":      "ceph/pool1",
+		"name":         "vol1",
+		"size":         1 << 30,
+		"object_size":  1 << 20,
+		"stripe_unit":  64 << 10,
+		"stripe_count": 16,
+	}
+
+	state := testMustApply(t, r, nil, config, meta)
+	testCheckAttr(t, state, "object_size", "1048576")
+	testCheckAttr(t, state, "stripe_unit", "65536")
+	testCheckAttr(t, state, "stripe_count", "16")
+	if diff := testPlan(t, r, state, config, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after apply, got %#v", diff)
+	}
+	config["stripe_count"] = 8
+	if diff := testPlan(t, r, state, config, meta); !diff.RequiresNew() {
+		t.Fatal("expect volume to be replaced when stripe_count changes")
+	}
+
+	config["name"] = "vol2"
+	config["stripe_unit"] = 3 << 20
+	if _, err := testApply(r, nil, config, meta); err == nil {
+		t.Fatal("expect error with stripe_unit larger than object_size")
+	}
+	config["object_size"] = 3 << 20
+	if _, err := testApply(r, nil, config, meta); err == nil {
+		t.Fatal("expect error with object_size not a power of two")
+	}
+	delete(config, "object_size")
+	delete(config, "stripe_count")
+	if _, err := testApply(r, nil, config, meta); err == nil {
+		t.Fatal("expect error with stripe_unit but no stripe_count")
+	}
+}
+
+func TestCephVolume_Import(t *testing.T) {
+	meta := testMeta("ceph")
+	client := testFakeClient(t, meta, "ceph")
+	_ = client.CreatePool("pool1", nil)
+	_, _ = client.CreateVol("pool1", "", "vol1", 1024, &sdk.VolumeConfig{Order: 20})
+	r := resourceCephVolume()
+
+	state, err := testImport(r, "ceph/pool1/vol1", meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.ID != "ceph/pool1/vol1" {
+		t.Fatalf("expect id ceph/pool1/vol1, got %s", state.ID)
+	}
+	testCheckAttr(t, state, "pool_id", "ceph/pool1")
+	testCheckAttr(t, state, "name", "vol1")
+	testCheckAttr(t, state, "size", "1024")
+	testCheckAttr(t, state, "object_size", "1048576")
+	testCheckAttr(t, state, "allow_shrink", "false")
+	if diff := testPlan(t, r, state, map[string]interface{}{
+		"pool_id":     "ceph/pool1",
+		"name":        "vol1",
+		"size":        1024,
+		"object_size": 1048576,
+	}, meta); !diff.Empty() {
+		t.Fatalf("expect empty plan after import, got %#v", diff)
+	}
+
+	for _, id := range []string{"pool1/vol1", "ceph/pool1/", "ceph//vol1", "ceph/pool1/vol1@snap1", "ceph/pool2/vol1", "ceph/pool1/vol2"} {
+		if _, err = testImport(r, id, meta); err == nil {
+			t.Fatalf("expect error importing '%s'", id)
+		}
+	}
+}
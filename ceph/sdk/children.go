@@ -0,0 +1,19 @@
+package sdk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChildrenError is returned when an image or a snapshot can't be removed
+// because clones depend on it
+type ChildrenError struct {
+	// Parent is the id of the image or snapshot
+	Parent string
+	// Children are the ids of the clones
+	Children []string
+}
+
+func (e *ChildrenError) Error() string {
+	return fmt.Sprintf("'%s' has clone children: %s", e.Parent, strings.Join(e.Children, ", "))
+}
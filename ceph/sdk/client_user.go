@@ -0,0 +1,9 @@
+package sdk
+
+// ClientUser is a cephx user `client.{Name}`
+type ClientUser struct {
+	Name string
+	Key  string
+	// Caps maps the daemon type (mon, osd, mgr, mds) to its capabilities
+	Caps map[string]string
+}
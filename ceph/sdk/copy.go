@@ -0,0 +1,66 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+)
+
+// Extent is a range of an image in bytes
+type Extent struct {
+	Offset uint64
+	Length uint64
+}
+
+// CopyVolData copies the data of src to dst in chunks of chunkSize, only the
+// allocated extents of src are read and chunks of zeros aren't written, so
+// dst has to be a new image which reads as zeros. It returns the number of
+// bytes written to dst, ctx aborts the copy between chunks.
+func CopyVolData(ctx context.Context, name string, src, dst CephVolumeI, chunkSize uint64) (uint64, error) {
+	if chunkSize == 0 {
+		return 0, fmt.Errorf("invalid chunk size 0")
+	}
+	extents, err := src.GetAllocatedExtents()
+	if err != nil {
+		return 0, fmt.Errorf("list allocated extents failed: %v", err)
+	}
+
+	var total, done, written uint64
+	for _, extent := range extents {
+		total += extent.Length
+	}
+	p := NewProgress(ctx, name)
+	buf := make([]byte, chunkSize)
+	for _, extent := range extents {
+		for offset, end := extent.Offset, extent.Offset+extent.Length; offset < end; offset += chunkSize {
+			if !p.Update(done, total) {
+				return written, fmt.Errorf("aborted at %d: %v", offset, ctx.Err())
+			}
+			chunk := buf
+			if end-offset < chunkSize {
+				chunk = buf[:end-offset]
+			}
+			done += uint64(len(chunk))
+			n, err := src.ReadAt(chunk, int64(offset))
+			if err != nil && n != len(chunk) {
+				return written, fmt.Errorf("read at %d failed: %v", offset, err)
+			}
+			if isZero(chunk) {
+				continue
+			}
+			if _, err = dst.WriteAt(chunk, int64(offset)); err != nil {
+				return written, fmt.Errorf("write at %d failed: %v", offset, err)
+			}
+			written += uint64(len(chunk))
+		}
+	}
+	return written, nil
+}
+
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
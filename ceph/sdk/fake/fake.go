@@ -0,0 +1,1925 @@
+package fake
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"terraform-provider-ceph/ceph/helper/mutexkv"
+	"terraform-provider-ceph/ceph/sdk"
+	"time"
+)
+
+// DefaultCapacity of every pool of the fake cluster
+const DefaultCapacity uint64 = 1 << 40
+
+// CephClient is an in-memory sdk.CephClientI, it models pools, images,
+// snapshots, clone parents, protection and flattening closely enough for the
+// resources to be exercised without a live cluster
+type CephClient struct {
+	cluster    string
+	MutexKV    *mutexkv.MutexKV
+	Mons       []string
+	CrushRules []string
+	// OpDelay is the duration of flatten, rollback and deep copy
+	OpDelay time.Duration
+
+	lock     sync.Mutex
+	pools    map[string]*pool
+	users    map[string]*user
+	profiles map[string]map[string]string
+	fsid     string
+}
+
+type pool struct {
+	name  string
+	opts  map[string]string
+	quota sdk.PoolQuota
+	apps  map[string]bool
+	// rbdInit is set by `rbd pool init`
+	rbdInit    bool
+	namespaces map[string]bool
+	// images by imageKey
+	images map[string]*image
+	// trash entries by id
+	trash map[string]*trashEntry
+	// metadata of `rbd config pool set` and the like
+	metadata map[string]string
+	// mirrorMode is one of the sdk.MirrorMode* constants, empty is none
+	mirrorMode  string
+	mirrorPeers []sdk.MirrorPeer
+}
+
+// trashEntry is an image moved to the trash of its pool
+type trashEntry struct {
+	id            string
+	image         *image
+	deletionTime  time.Time
+	deferredUntil time.Time
+}
+
+type image struct {
+	pool        *pool
+	namespace   string
+	name        string
+	size        uint64
+	dataPool    string
+	order       uint64
+	features    uint64
+	stripeUnit  uint64
+	stripeCount uint64
+	parent      *snapshot
+	overlap     uint64 // the part of a clone backed by parent, it only shrinks
+	snaps       []*snapshot
+	data        blocks
+	metadata    map[string]string
+	mirror      *sdk.MirrorImageInfo // nil unless mirroring is enabled
+}
+
+// defaultFeatures of new images, the default of librbd since luminous
+const defaultFeatures = sdk.FeatureLayering | sdk.FeatureExclusiveLock | sdk.FeatureObjectMap |
+	sdk.FeatureFastDiff | sdk.FeatureDeepFlatten
+
+// mutableFeatures can be enabled and disabled on existing images, deep-flatten
+// can only be disabled
+const mutableFeatures = sdk.FeatureExclusiveLock | sdk.FeatureObjectMap | sdk.FeatureFastDiff | sdk.FeatureJournaling
+
+type snapshot struct {
+	image     *image
+	name      string
+	size      uint64
+	protected bool
+	data      blocks
+}
+
+// blockSize of the data of fake images
+const blockSize = 4096
+
+// blocks are the written blocks of an image by offset, unwritten blocks read as zeros
+type blocks map[uint64][]byte
+
+func (b blocks) clone() blocks {
+	ret := make(blocks, len(b))
+	for offset, block := range b {
+		ret[offset] = append([]byte(nil), block...)
+	}
+	return ret
+}
+
+func (b blocks) readAt(p []byte, off uint64) {
+	for i := range p {
+		pos := off + uint64(i)
+		if block, ok := b[pos/blockSize*blockSize]; ok {
+			p[i] = block[pos%blockSize]
+		} else {
+			p[i] = 0
+		}
+	}
+}
+
+func (b blocks) writeAt(p []byte, off uint64) {
+	for i, c := range p {
+		pos := off + uint64(i)
+		block, ok := b[pos/blockSize*blockSize]
+		if !ok {
+			block = make([]byte, blockSize)
+			b[pos/blockSize*blockSize] = block
+		}
+		block[pos%blockSize] = c
+	}
+}
+
+// truncate drops the blocks beyond size
+func (b blocks) truncate(size uint64) {
+	for offset, block := range b {
+		if offset >= size {
+			delete(b, offset)
+		} else if offset+blockSize > size {
+			for i := size - offset; i < blockSize; i++ {
+				block[i] = 0
+			}
+		}
+	}
+}
+
+// extents returns the written ranges, merged and sorted
+func (b blocks) extents(size uint64) []sdk.Extent {
+	offsets := make([]uint64, 0, len(b))
+	for offset := range b {
+		if offset < size {
+			offsets = append(offsets, offset)
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	var ret []sdk.Extent
+	for _, offset := range offsets {
+		length := uint64(blockSize)
+		if offset+length > size {
+			length = size - offset
+		}
+		if n := len(ret); n > 0 && ret[n-1].Offset+ret[n-1].Length == offset {
+			ret[n-1].Length += length
+		} else {
+			ret = append(ret, sdk.Extent{Offset: offset, Length: length})
+		}
+	}
+	return ret
+}
+
+type user struct {
+	key  string
+	caps map[string]string
+}
+
+var _ sdk.CephClientI = (*CephClient)(nil)
+
+// NewCephClient generate an empty in-memory cluster
+func NewCephClient(cluster string) *CephClient {
+	return &CephClient{
+		cluster:    cluster,
+		fsid:       newUUID(),
+		MutexKV:    mutexkv.NewMutexKV(),
+		Mons:       []string{"127.0.0.1:6789"},
+		CrushRules: []string{"replicated_rule"},
+		pools:      make(map[string]*pool),
+		users:      make(map[string]*user),
+		profiles: map[string]map[string]string{
+			"default": {"k": "2", "m": "2", "plugin": "jerasure", "technique": "reed_sol_van"},
+		},
+	}
+}
+
+// newUUID returns a random uuid like the ones of ceph
+func newUUID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:])
+}
+
+// errors formatted like the ones of go-ceph
+var (
+	errImageNotFound = errors.New("RBD image not found")
+	errNotFound      = radosError(syscall.ENOENT)
+)
+
+func rbdError(errno syscall.Errno) error {
+	return fmt.Errorf("rbd: ret=%d, %s", int(errno), errno)
+}
+
+func radosError(errno syscall.Errno) error {
+	return fmt.Errorf("rados: ret=%d, %s", int(errno), errno)
+}
+
+// monError formats errors the way goceph.CephClient reports failed mon commands
+func monError(prefix string, errno syscall.Errno, format string, a ...interface{}) error {
+	return fmt.Errorf("ceph %s failed: %v, %s", prefix, radosError(errno), fmt.Sprintf(format, a...))
+}
+
+// Shutdown does nothing, there is no connection to close
+func (c *CephClient) Shutdown() {}
+
+// WithContext returns the client itself, the in-memory cluster doesn't block,
+// only long running operations take their ctx
+func (c *CephClient) WithContext(ctx context.Context) sdk.CephClientI {
+	return c
+}
+
+// GetMutexKV returns the locks shared by resources of the cluster
+func (c *CephClient) GetMutexKV() *mutexkv.MutexKV {
+	return c.MutexKV
+}
+
+// Version of the fake cluster, in the format of `ceph version`
+func (c *CephClient) Version() (string, error) {
+	buf, _ := json.Marshal(map[string]string{"version": "ceph version 15.2.0 (fake) octopus (stable)"})
+	return string(buf), nil
+}
+
+// GetMons get ceph mons
+func (c *CephClient) GetMons() ([]string, error) {
+	return append([]string(nil), c.Mons...), nil
+}
+
+// InitClientUser init client user auth for pool
+func (c *CephClient) InitClientUser(username string, pools ...string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	u, ok := c.users[username]
+	if !ok {
+		var err error
+		if u, err = c.newUser(username, nil); err != nil {
+			return "", err
+		}
+	}
+	if len(pools) == 0 {
+		return u.key, nil
+	}
+	if _, ok := u.caps["mon"]; !ok {
+		u.caps["mon"] = "allow r"
+	}
+	if _, ok := u.caps["osd"]; !ok {
+		u.caps["osd"] = "allow class-read object_prefix rbd_children"
+	}
+	for _, p := range pools {
+		if strings.Contains(u.caps["osd"], "pool="+p) {
+			continue
+		}
+		u.caps["osd"] += fmt.Sprintf(", allow rwx pool=%s", p)
+	}
+	return u.key, nil
+}
+
+// checkCaps fails like the auth commands for unknown daemon types or caps
+// without allow or profile grants
+func checkCaps(prefix string, caps map[string]string) error {
+	for daemon, grants := range caps {
+		switch daemon {
+		case "mon", "osd", "mgr", "mds":
+		default:
+			return monError(prefix, syscall.EINVAL, "unknown daemon type %s", daemon)
+		}
+		for _, grant := range strings.Split(grants, ",") {
+			grant = strings.TrimSpace(grant)
+			if !strings.HasPrefix(grant, "allow") && !strings.HasPrefix(grant, "profile ") {
+				return monError(prefix, syscall.EINVAL, "%scap parse failed, stopped at '%s'", daemon, grant)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *CephClient) newUser(name string, caps map[string]string) (*user, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	u := &user{key: base64.StdEncoding.EncodeToString(buf), caps: make(map[string]string, len(caps))}
+	for k, v := range caps {
+		u.caps[k] = v
+	}
+	c.users[name] = u
+	return u, nil
+}
+
+func (u *user) clientUser(name string) *sdk.ClientUser {
+	ret := &sdk.ClientUser{Name: name, Key: u.key, Caps: make(map[string]string, len(u.caps))}
+	for k, v := range u.caps {
+		ret.Caps[k] = v
+	}
+	return ret
+}
+
+// GetClientUser returns nil if the user not exists
+func (c *CephClient) GetClientUser(name string) (*sdk.ClientUser, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	u, ok := c.users[name]
+	if !ok {
+		return nil, nil
+	}
+	return u.clientUser(name), nil
+}
+
+// CreateClientUser fails like `ceph auth get-or-create` if the user exists
+// with other caps
+func (c *CephClient) CreateClientUser(name string, caps map[string]string) (*sdk.ClientUser, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	const prefix = "auth get-or-create"
+	if err := checkCaps(prefix, caps); err != nil {
+		return nil, err
+	}
+	if u, ok := c.users[name]; ok {
+		if fmt.Sprint(u.caps) != fmt.Sprint(caps) && !(len(u.caps) == 0 && len(caps) == 0) {
+			return nil, monError(prefix, syscall.EINVAL, "key for client.%s exists but caps do not match", name)
+		}
+		return u.clientUser(name), nil
+	}
+	u, err := c.newUser(name, caps)
+	if err != nil {
+		return nil, err
+	}
+	return u.clientUser(name), nil
+}
+
+// SetClientUserCaps replaces all caps of user
+func (c *CephClient) SetClientUserCaps(name string, caps map[string]string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	const prefix = "auth caps"
+	u, ok := c.users[name]
+	if !ok {
+		return monError(prefix, syscall.ENOENT, "couldn't find entry client.%s", name)
+	}
+	if err := checkCaps(prefix, caps); err != nil {
+		return err
+	}
+	u.caps = make(map[string]string, len(caps))
+	for k, v := range caps {
+		u.caps[k] = v
+	}
+	return nil
+}
+
+// DeleteClientUser delete user, it's not an error if the user not exists
+func (c *CephClient) DeleteClientUser(name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.users, name)
+	return nil
+}
+
+// ExistPool check if pool exists
+func (c *CephClient) ExistPool(name string) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, ok := c.pools[name]
+	return ok, nil
+}
+
+// CreatePool create replicated pool, fails if it exists
+func (c *CephClient) CreatePool(name string, config *sdk.PoolConfig) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.pools[name]; ok {
+		return monError("osd pool create", syscall.EEXIST, "pool '%s' already exists", name)
+	}
+	if config == nil {
+		config = &sdk.PoolConfig{}
+	}
+	p := &pool{
+		name: name,
+		opts: map[string]string{
+			"size":              "3",
+			"min_size":          "2",
+			"pg_num":            "32",
+			"pgp_num":           "32",
+			"crush_rule":        "replicated_rule",
+			"pg_autoscale_mode": "on",
+		},
+		apps:       make(map[string]bool),
+		namespaces: make(map[string]bool),
+		images:     make(map[string]*image),
+		trash:      make(map[string]*trashEntry),
+	}
+	if config.CrushRule != "" {
+		if !c.existCrushRule(config.CrushRule) {
+			return monError("osd pool create", syscall.ENOENT, "specified rule %s doesn't exist", config.CrushRule)
+		}
+		p.opts["crush_rule"] = config.CrushRule
+	}
+	if config.PgNum > 0 {
+		p.opts["pg_num"] = strconv.Itoa(config.PgNum)
+		p.opts["pgp_num"] = p.opts["pg_num"]
+	}
+	if config.PgpNum > 0 {
+		p.opts["pgp_num"] = strconv.Itoa(config.PgpNum)
+	}
+	if config.PoolType == "erasure" {
+		profileName := config.ErasureCodeProfile
+		if profileName == "" {
+			profileName = "default"
+		}
+		profile, ok := c.profiles[profileName]
+		if !ok {
+			return monError("osd pool create", syscall.ENOENT, "specified erasure code profile %s doesn't exist", profileName)
+		}
+		k, _ := strconv.Atoi(profile["k"])
+		m, _ := strconv.Atoi(profile["m"])
+		p.opts["size"] = strconv.Itoa(k + m)
+		p.opts["min_size"] = strconv.Itoa(k + 1)
+		p.opts["erasure_code_profile"] = profileName
+		p.opts["allow_ec_overwrites"] = "false"
+		if config.CrushRule == "" {
+			p.opts["crush_rule"] = name
+		}
+	} else if config.PoolType != "" && config.PoolType != "replicated" {
+		return monError("osd pool create", syscall.EINVAL, "unknown pool type '%s'", config.PoolType)
+	}
+	c.pools[name] = p
+	return nil
+}
+
+func (c *CephClient) existCrushRule(name string) bool {
+	return inSlice(name, c.CrushRules)
+}
+
+func inSlice(x string, y []string) bool {
+	for _, v := range y {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPoolOption set pool variable, validated like `ceph osd pool set`
+func (c *CephClient) SetPoolOption(name, key, value string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	const prefix = "osd pool set"
+	p, ok := c.pools[name]
+	if !ok {
+		return monError(prefix, syscall.ENOENT, "unrecognized pool '%s'", name)
+	}
+	switch key {
+	case "size", "min_size", "pg_num", "pgp_num":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return monError(prefix, syscall.EINVAL, "error parsing integer value '%s'", value)
+		}
+		size, _ := strconv.Atoi(p.opts["size"])
+		pgNum, _ := strconv.Atoi(p.opts["pg_num"])
+		_, erasure := p.opts["erasure_code_profile"]
+		switch {
+		case key == "size" && erasure:
+			return monError(prefix, syscall.ENOTSUP, "can not change the size of an erasure-coded pool")
+		case key == "size" && n > 10:
+			return monError(prefix, syscall.EINVAL, "pool size must be between 1 and 10")
+		case key == "min_size" && n > size:
+			return monError(prefix, syscall.EINVAL, "pool min_size must be between 1 and size, which is set to %d", size)
+		case key == "pgp_num" && n > pgNum:
+			return monError(prefix, syscall.EINVAL, "specified pgp_num %d > pg_num %d", n, pgNum)
+		}
+		p.opts[key] = value
+		// ceph lowers min_size and pgp_num along with size and pg_num
+		if minSize, _ := strconv.Atoi(p.opts["min_size"]); key == "size" && minSize > n {
+			p.opts["min_size"] = value
+		}
+		if pgpNum, _ := strconv.Atoi(p.opts["pgp_num"]); key == "pg_num" && pgpNum > n {
+			p.opts["pgp_num"] = value
+		}
+	case "pg_autoscale_mode":
+		if value != "on" && value != "off" && value != "warn" {
+			return monError(prefix, syscall.EINVAL, "invalid autoscale mode '%s'", value)
+		}
+		p.opts[key] = value
+	case "allow_ec_overwrites":
+		if _, erasure := p.opts["erasure_code_profile"]; !erasure {
+			return monError(prefix, syscall.EINVAL, "ec overwrites can only be enabled for an erasure coded pool")
+		} else if value != "true" && p.opts[key] == "true" {
+			return monError(prefix, syscall.EINVAL, "ec overwrites cannot be disabled once enabled")
+		}
+		p.opts[key] = value
+	case "compression_mode", "compression_algorithm":
+		valid := map[string][]string{
+			"compression_mode":      {"none", "passive", "aggressive", "force"},
+			"compression_algorithm": {"none", "snappy", "zlib", "zstd", "lz4"},
+		}
+		if !inSlice(value, valid[key]) {
+			return monError(prefix, syscall.EINVAL, "unrecognized %s '%s'", key, value)
+		}
+		p.opts[key] = value
+	case "compression_required_ratio":
+		if f, err := strconv.ParseFloat(value, 64); err != nil || f < 0 || f > 1 {
+			return monError(prefix, syscall.EINVAL, "value must be in the range [0, 1]")
+		}
+		p.opts[key] = value
+	case "compression_min_blob_size", "compression_max_blob_size":
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return monError(prefix, syscall.EINVAL, "error parsing integer value '%s'", value)
+		}
+		p.opts[key] = value
+	case "crush_rule":
+		if !c.existCrushRule(value) && value != name {
+			return monError(prefix, syscall.ENOENT, "crush rule %s does not exist", value)
+		}
+		p.opts[key] = value
+	default:
+		return monError(prefix, syscall.EINVAL, "unrecognized variable '%s'", key)
+	}
+	return nil
+}
+
+// GetPoolOptions returns the variables of the pool
+func (c *CephClient) GetPoolOptions(name string) (map[string]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, ok := c.pools[name]
+	if !ok {
+		return nil, monError("osd pool get", syscall.ENOENT, "unrecognized pool '%s'", name)
+	}
+	ret := map[string]string{"pool": name}
+	for k, v := range p.opts {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+// SetPoolQuota set both limits of pool
+func (c *CephClient) SetPoolQuota(name string, quota *sdk.PoolQuota) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, ok := c.pools[name]
+	if !ok {
+		return monError("osd pool set-quota", syscall.ENOENT, "unrecognized pool '%s'", name)
+	}
+	p.quota = *quota
+	return nil
+}
+
+// GetPoolQuota returns the limits of pool
+func (c *CephClient) GetPoolQuota(name string) (*sdk.PoolQuota, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, ok := c.pools[name]
+	if !ok {
+		return nil, monError("osd pool get-quota", syscall.ENOENT, "unrecognized pool '%s'", name)
+	}
+	quota := p.quota
+	return &quota, nil
+}
+
+// GetPoolApplications returns the applications enabled on pool, sorted
+func (c *CephClient) GetPoolApplications(name string) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, ok := c.pools[name]
+	if !ok {
+		return nil, monError("osd pool application get", syscall.ENOENT, "unrecognized pool '%s'", name)
+	}
+	apps := make([]string, 0, len(p.apps))
+	for app := range p.apps {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	return apps, nil
+}
+
+// EnablePoolApplication enable app on pool
+func (c *CephClient) EnablePoolApplication(name, app string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	const prefix = "osd pool application enable"
+	p, ok := c.pools[name]
+	if !ok {
+		return monError(prefix, syscall.ENOENT, "unrecognized pool '%s'", name)
+	} else if app == "" || len(app) > 128 {
+		return monError(prefix, syscall.EINVAL, "application name '%s' is invalid", app)
+	}
+	p.apps[app] = true
+	return nil
+}
+
+// DisablePoolApplication disable app on pool, it's not an error if the app
+// is not enabled
+func (c *CephClient) DisablePoolApplication(name, app string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, ok := c.pools[name]
+	if !ok {
+		return monError("osd pool application disable", syscall.ENOENT, "unrecognized pool '%s'", name)
+	}
+	delete(p.apps, app)
+	return nil
+}
+
+// InitRBDPool initializes pool for rbd and enables the rbd application
+func (c *CephClient) InitRBDPool(name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(name)
+	if err != nil {
+		return err
+	}
+	p.apps["rbd"] = true
+	p.rbdInit = true
+	return nil
+}
+
+func (c *CephClient) ListPoolMetadata(name string) (map[string]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(name)
+	if err != nil {
+		return nil, err
+	}
+	return copyMetadata(p.metadata), nil
+}
+
+func (c *CephClient) SetPoolMetadata(name, key, value string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(name)
+	if err != nil {
+		return err
+	}
+	if p.metadata == nil {
+		p.metadata = make(map[string]string)
+	}
+	p.metadata[key] = value
+	return nil
+}
+
+// RemovePoolMetadata fails like librbd for missing keys
+func (c *CephClient) RemovePoolMetadata(name, key string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(name)
+	if err != nil {
+		return err
+	} else if _, ok := p.metadata[key]; !ok {
+		return rbdError(syscall.ENOENT)
+	}
+	delete(p.metadata, key)
+	return nil
+}
+
+// IsRBDPoolInitialized reports if InitRBDPool was called on pool
+func (c *CephClient) IsRBDPoolInitialized(name string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, ok := c.pools[name]
+	return ok && p.rbdInit
+}
+
+// DeletePool delete pool with all its images
+func (c *CephClient) DeletePool(name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.pools, name)
+	return nil
+}
+
+// GetInfo returns the usage of pool, allocation is the sum of image sizes
+func (c *CephClient) GetInfo(poolName string) (*sdk.StoragePoolInfo, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, ok := c.pools[poolName]
+	if !ok {
+		return nil, fmt.Errorf("storagepool %s doesn't exist", poolName)
+	}
+	var allocation uint64
+	for _, img := range p.images {
+		allocation += img.size
+	}
+	return &sdk.StoragePoolInfo{
+		Capacity:   DefaultCapacity,
+		Allocation: allocation,
+		Available:  DefaultCapacity - allocation,
+		State:      2,
+		StateDp:    "HEALTH_OK",
+	}, nil
+}
+
+// SetErasureCodeProfile create erasure code profile, an existing profile is
+// only accepted with the same settings
+func (c *CephClient) SetErasureCodeProfile(name string, profile map[string]string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	const prefix = "osd erasure-code-profile set"
+	if _, ok := profile["k"]; !ok {
+		return monError(prefix, syscall.EINVAL, "k must be set")
+	}
+	if _, ok := profile["m"]; !ok {
+		return monError(prefix, syscall.EINVAL, "m must be set")
+	}
+	newProfile := map[string]string{"plugin": "jerasure", "crush-failure-domain": "host"}
+	for k, v := range profile {
+		newProfile[k] = v
+	}
+	if _, ok := newProfile["technique"]; !ok && newProfile["plugin"] == "jerasure" {
+		newProfile["technique"] = "reed_sol_van"
+	}
+	if old, ok := c.profiles[name]; ok {
+		if fmt.Sprint(old) != fmt.Sprint(newProfile) {
+			return monError(prefix, syscall.EPERM, "will not override erasure code profile %s", name)
+		}
+		return nil
+	}
+	c.profiles[name] = newProfile
+	return nil
+}
+
+// GetErasureCodeProfile returns nil if the profile not exists
+func (c *CephClient) GetErasureCodeProfile(name string) (map[string]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	profile, ok := c.profiles[name]
+	if !ok {
+		return nil, nil
+	}
+	ret := make(map[string]string, len(profile))
+	for k, v := range profile {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+// DeleteErasureCodeProfile fails while the profile is used by a pool
+func (c *CephClient) DeleteErasureCodeProfile(name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, p := range c.pools {
+		if p.opts["erasure_code_profile"] == name {
+			return monError("osd erasure-code-profile rm", syscall.EBUSY, "%s: pool %s is using the erasure code profile", name, p.name)
+		}
+	}
+	delete(c.profiles, name)
+	return nil
+}
+
+func (c *CephClient) getPool(name string) (*pool, error) {
+	p, ok := c.pools[name]
+	if !ok {
+		return nil, fmt.Errorf("can't get ioctx of pool '%s': %v", name, errNotFound)
+	}
+	return p, nil
+}
+
+// checkDataPool fails like librbd if the data pool can't store rbd data
+func (c *CephClient) checkDataPool(config *sdk.VolumeConfig) error {
+	if config == nil || config.DataPool == "" {
+		return nil
+	}
+	p, ok := c.pools[config.DataPool]
+	if !ok {
+		return errImageNotFound
+	}
+	if _, erasure := p.opts["erasure_code_profile"]; erasure && p.opts["allow_ec_overwrites"] != "true" {
+		return rbdError(syscall.EOPNOTSUPP)
+	}
+	return nil
+}
+
+// imageKey is the key of images of a pool, images of different
+// namespaces may have the same name
+func imageKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// imageSpec formats images like the rbd cli, {pool}/[{namespace}/]{image}
+func imageSpec(poolName, namespace, name string) string {
+	if namespace == "" {
+		return poolName + "/" + name
+	}
+	return poolName + "/" + namespace + "/" + name
+}
+
+// checkNamespace fails like librbd if the namespace of pool doesn't exist
+func (p *pool) checkNamespace(namespace string) error {
+	if namespace != "" && !p.namespaces[namespace] {
+		return errImageNotFound
+	}
+	return nil
+}
+
+// CloneImg clone image from a protected snapshot
+func (c *CephClient) CloneImg(basePool, baseNamespace, baseName, baseSnap, poolName, namespace, name string, config *sdk.VolumeConfig) (sdk.CephVolumeI, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(poolName)
+	if err != nil {
+		return nil, err
+	}
+	if basePool == "" {
+		basePool = poolName
+	}
+	bp, err := c.getPool(basePool)
+	if err != nil {
+		return nil, err
+	}
+
+	baseSpec := imageSpec(basePool, baseNamespace, baseName)
+	var snap *snapshot
+	if base, ok := bp.images[imageKey(baseNamespace, baseName)]; ok {
+		snap = base.lookupSnap(baseSnap)
+	}
+	if snap == nil {
+		return nil, fmt.Errorf("clone image '%s@%s' failed: %v", baseSpec, baseSnap, errImageNotFound)
+	} else if !snap.protected {
+		return nil, fmt.Errorf("clone image '%s@%s' failed: %v", baseSpec, baseSnap, rbdError(syscall.EINVAL))
+	} else if err = p.checkNamespace(namespace); err != nil {
+		return nil, fmt.Errorf("clone image '%s@%s' failed: %v", baseSpec, baseSnap, err)
+	} else if _, ok := p.images[imageKey(namespace, name)]; ok {
+		return nil, fmt.Errorf("clone image '%s@%s' failed: %v", baseSpec, baseSnap, rbdError(syscall.EEXIST))
+	}
+
+	if err = c.checkDataPool(config); err != nil {
+		return nil, fmt.Errorf("clone image '%s@%s' failed: %v", baseSpec, baseSnap, err)
+	}
+
+	// the data of the parent is copied instead of read through, clones
+	// inherit the metadata of the parent like in librbd
+	img := &image{pool: p, namespace: namespace, name: name, size: snap.size, parent: snap, overlap: snap.size, data: snap.data.clone(),
+		metadata: copyMetadata(snap.image.metadata)}
+	if err = img.configure(config, sdk.FeatureLayering); err != nil {
+		return nil, fmt.Errorf("clone image '%s@%s' failed: %v", baseSpec, baseSnap, err)
+	}
+	p.images[imageKey(namespace, name)] = img
+	return &volume{client: c, image: img}, nil
+}
+
+// wait takes OpDelay like a long running operation of librbd, which is
+// aborted when ctx is done first
+func (c *CephClient) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-time.After(c.OpDelay):
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("aborted: %v", ctx.Err())
+	}
+}
+
+// DeepCopyImg copies the image with its snapshots up to baseSnap like
+// `rbd deep cp --flatten`, zero values of config are taken from the base image
+func (c *CephClient) DeepCopyImg(ctx context.Context, basePool, baseNamespace, baseName, baseSnap, poolName, namespace, name string, config *sdk.VolumeConfig) (sdk.CephVolumeI, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(poolName)
+	if err != nil {
+		return nil, err
+	}
+	bp, err := c.getPool(basePool)
+	if err != nil {
+		return nil, err
+	}
+
+	baseSpec := imageSpec(basePool, baseNamespace, baseName)
+	base, ok := bp.images[imageKey(baseNamespace, baseName)]
+	var snap *snapshot
+	if ok {
+		snap = base.lookupSnap(baseSnap)
+	}
+	if snap == nil {
+		return nil, fmt.Errorf("deep copy image '%s@%s' failed: %v", baseSpec, baseSnap, errImageNotFound)
+	} else if err = p.checkNamespace(namespace); err != nil {
+		return nil, fmt.Errorf("deep copy image '%s@%s' failed: %v", baseSpec, baseSnap, err)
+	} else if _, ok := p.images[imageKey(namespace, name)]; ok {
+		return nil, fmt.Errorf("deep copy image '%s@%s' failed: %v", baseSpec, baseSnap, rbdError(syscall.EEXIST))
+	}
+
+	cfg := sdk.VolumeConfig{}
+	if config != nil {
+		cfg = *config
+	}
+	if cfg.Order == 0 {
+		cfg.Order = base.order
+	}
+	if cfg.DataPool == "" {
+		cfg.DataPool = base.dataPool
+	}
+	if cfg.StripeUnit == 0 && cfg.StripeCount == 0 && base.features&sdk.FeatureStripingV2 != 0 {
+		cfg.StripeUnit, cfg.StripeCount = base.stripeUnit, base.stripeCount
+	}
+	if err = c.checkDataPool(&cfg); err != nil {
+		return nil, fmt.Errorf("deep copy image '%s@%s' failed: %v", baseSpec, baseSnap, err)
+	}
+
+	// features of config replace the ones of the base, layering included
+	features := base.features &^ (sdk.FeatureStripingV2 | sdk.FeatureDataPool)
+	if cfg.Features != 0 {
+		features = 0
+	}
+	img := &image{pool: p, namespace: namespace, name: name, size: snap.size, data: snap.data.clone(),
+		metadata: copyMetadata(base.metadata)}
+	if err = img.configure(&cfg, features); err != nil {
+		return nil, fmt.Errorf("deep copy image '%s@%s' failed: %v", baseSpec, baseSnap, err)
+	}
+	for _, s := range base.snaps {
+		img.snaps = append(img.snaps, &snapshot{image: img, name: s.name, size: s.size, protected: s.protected, data: s.data.clone()})
+		if s == snap {
+			break
+		}
+	}
+	p.images[imageKey(namespace, name)] = img
+	return &volume{client: c, image: img}, nil
+}
+
+// CreateVol create image in the namespace of pool
+func (c *CephClient) CreateVol(poolName, namespace, name string, size uint64, config *sdk.VolumeConfig) (sdk.CephVolumeI, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(poolName)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	if _, ok := p.images[imageKey(namespace, name)]; ok {
+		return nil, rbdError(syscall.EEXIST)
+	}
+	if err = c.checkDataPool(config); err != nil {
+		return nil, err
+	}
+
+	img := &image{pool: p, namespace: namespace, name: name, size: size, data: make(blocks)}
+	if err = img.configure(config, defaultFeatures); err != nil {
+		return nil, err
+	}
+	p.images[imageKey(namespace, name)] = img
+	return &volume{client: c, image: img}, nil
+}
+
+// DeleteVol delete image, fails like rbd_remove while it has snapshots
+func (c *CephClient) DeleteVol(poolName, namespace, name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(poolName)
+	if err != nil {
+		return err
+	}
+	img, ok := p.images[imageKey(namespace, name)]
+	if !ok {
+		return nil
+	}
+	if children := c.imageChildIDs(img); len(children) > 0 {
+		return &sdk.ChildrenError{Parent: c.imageID(img), Children: children}
+	}
+	if len(img.snaps) > 0 {
+		return rbdError(syscall.ENOTEMPTY)
+	}
+	delete(p.images, imageKey(namespace, name))
+	return nil
+}
+
+// TrashVol moves the image to the trash of its pool
+func (c *CephClient) TrashVol(poolName, namespace, name string, delay time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(poolName)
+	if err != nil {
+		return err
+	}
+	img, ok := p.images[imageKey(namespace, name)]
+	if !ok {
+		return nil
+	}
+	buf := make([]byte, 6)
+	if _, err = rand.Read(buf); err != nil {
+		return err
+	}
+	now := time.Now()
+	entry := &trashEntry{id: fmt.Sprintf("%x", buf), image: img, deletionTime: now, deferredUntil: now.Add(delay)}
+	p.trash[entry.id] = entry
+	delete(p.images, imageKey(namespace, name))
+	return nil
+}
+
+// ListTrash returns the trash entries of the namespace, oldest first
+func (c *CephClient) ListTrash(poolName, namespace string) ([]sdk.TrashEntry, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(poolName)
+	if err != nil {
+		return nil, err
+	} else if err = p.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	var entries []sdk.TrashEntry
+	for _, entry := range p.trash {
+		if entry.image.namespace == namespace {
+			entries = append(entries, sdk.TrashEntry{
+				ID:            entry.id,
+				Name:          entry.image.name,
+				DeletionTime:  entry.deletionTime,
+				DeferredUntil: entry.deferredUntil,
+			})
+		}
+	}
+	sdk.SortTrash(entries)
+	return entries, nil
+}
+
+// RestoreVolFromTrash restores the trash entry as image name
+func (c *CephClient) RestoreVolFromTrash(poolName, namespace, id, name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(poolName)
+	if err != nil {
+		return err
+	}
+	entry, ok := p.trash[id]
+	if !ok || entry.image.namespace != namespace {
+		return errImageNotFound
+	} else if _, ok = p.images[imageKey(namespace, name)]; ok {
+		return rbdError(syscall.EEXIST)
+	}
+	entry.image.name = name
+	p.images[imageKey(namespace, name)] = entry.image
+	delete(p.trash, id)
+	return nil
+}
+
+// DeleteSnap delete snapshot of image
+func (c *CephClient) DeleteSnap(poolName, namespace, name, snapName string) error {
+	vol, err := c.LookupVolByName(poolName, namespace, name)
+	if err != nil {
+		return err
+	} else if vol == nil {
+		return nil
+	}
+	defer vol.Close()
+
+	snap, err := vol.LookupSnapByName(snapName)
+	if err != nil {
+		return err
+	} else if snap == nil {
+		return nil
+	}
+	return snap.Remove()
+}
+
+// LookupVolByName returns nil if image not exists
+func (c *CephClient) LookupVolByName(poolName, namespace, name string) (sdk.CephVolumeI, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, ok := c.pools[poolName]
+	if !ok {
+		return nil, errNotFound
+	}
+	img, ok := p.images[imageKey(namespace, name)]
+	if !ok {
+		return nil, nil
+	}
+	return &volume{client: c, image: img}, nil
+}
+
+// OpenVolSnapshot returns nil if the image or the snapshot doesn't exist,
+// the snapshot is read-only
+func (c *CephClient) OpenVolSnapshot(poolName, namespace, name, snapName string) (sdk.CephVolumeI, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, ok := c.pools[poolName]
+	if !ok {
+		return nil, errNotFound
+	}
+	img, ok := p.images[imageKey(namespace, name)]
+	if !ok {
+		return nil, nil
+	}
+	snap := img.lookupSnap(snapName)
+	if snap == nil {
+		return nil, nil
+	}
+	return &volume{client: c, image: img, snap: snap}, nil
+}
+
+// ListVols returns the image names of the namespace of pool, sorted
+func (c *CephClient) ListVols(poolName, namespace string) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, ok := c.pools[poolName]
+	if !ok {
+		return nil, errNotFound
+	}
+	if err := p.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(p.images))
+	for _, img := range p.images {
+		if img.namespace == namespace {
+			names = append(names, img.name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ListRBDNamespaces returns the rbd namespaces of pool, sorted
+func (c *CephClient) ListRBDNamespaces(poolName string) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(poolName)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(p.namespaces))
+	for name := range p.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CreateRBDNamespace fails like librbd if the namespace exists
+func (c *CephClient) CreateRBDNamespace(poolName, namespace string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(poolName)
+	if err != nil {
+		return err
+	}
+	if namespace == "" {
+		return rbdError(syscall.EINVAL)
+	} else if p.namespaces[namespace] {
+		return rbdError(syscall.EEXIST)
+	}
+	p.namespaces[namespace] = true
+	return nil
+}
+
+// DeleteRBDNamespace fails like librbd while there are images in the namespace
+func (c *CephClient) DeleteRBDNamespace(poolName, namespace string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(poolName)
+	if err != nil {
+		return err
+	}
+	for _, img := range p.images {
+		if img.namespace == namespace {
+			return rbdError(syscall.EBUSY)
+		}
+	}
+	for _, entry := range p.trash {
+		if entry.image.namespace == namespace {
+			return rbdError(syscall.EBUSY)
+		}
+	}
+	delete(p.namespaces, namespace)
+	return nil
+}
+
+// children returns the images cloned from snap, sorted by pool, namespace and name
+func (c *CephClient) children(snap *snapshot) []*image {
+	var ret []*image
+	for _, p := range c.pools {
+		for _, img := range p.images {
+			if img.parent == snap {
+				ret = append(ret, img)
+			}
+		}
+		// clones in the trash still depend on their parent
+		for _, entry := range p.trash {
+			if entry.image.parent == snap {
+				ret = append(ret, entry.image)
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].pool.name != ret[j].pool.name {
+			return ret[i].pool.name < ret[j].pool.name
+		} else if ret[i].namespace != ret[j].namespace {
+			return ret[i].namespace < ret[j].namespace
+		}
+		return ret[i].name < ret[j].name
+	})
+	return ret
+}
+
+// imageID returns the id of the image like sdk.FormatCephVol
+func (c *CephClient) imageID(img *image) string {
+	return sdk.FormatCephVol(c.cluster, img.pool.name, img.namespace, img.name)
+}
+
+// childIDs returns the ids of the children of snap
+func (c *CephClient) childIDs(snap *snapshot) []string {
+	var ids []string
+	for _, child := range c.children(snap) {
+		ids = append(ids, c.imageID(child))
+	}
+	return ids
+}
+
+// imageChildIDs returns the ids of the children of all snapshots of img
+func (c *CephClient) imageChildIDs(img *image) []string {
+	var ids []string
+	for _, snap := range img.snaps {
+		ids = append(ids, c.childIDs(snap)...)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// configure applies the options of a new image like librbd, features
+// replace the defaults except layering which clones always have
+func (img *image) configure(config *sdk.VolumeConfig, features uint64) error {
+	if config == nil {
+		config = &sdk.VolumeConfig{}
+	}
+	img.order = 22
+	if config.Order != 0 {
+		if config.Order < 12 || config.Order > 25 {
+			return rbdError(syscall.EDOM)
+		}
+		img.order = config.Order
+	}
+	if config.Features != 0 {
+		features = config.Features | features&sdk.FeatureLayering
+	}
+	objectSize := uint64(1) << img.order
+	img.stripeUnit, img.stripeCount = objectSize, 1
+	if config.StripeUnit != 0 || config.StripeCount != 0 {
+		if config.StripeUnit == 0 || config.StripeCount == 0 ||
+			config.StripeUnit > objectSize || objectSize%config.StripeUnit != 0 {
+			return rbdError(syscall.EINVAL)
+		}
+		img.stripeUnit, img.stripeCount = config.StripeUnit, config.StripeCount
+	}
+	if img.stripeUnit != objectSize || img.stripeCount != 1 {
+		features |= sdk.FeatureStripingV2
+	}
+	img.dataPool = config.DataPool
+	if img.dataPool != "" {
+		features |= sdk.FeatureDataPool
+	}
+	if !validFeatures(features) {
+		return rbdError(syscall.EINVAL)
+	}
+	img.features = features
+	return nil
+}
+
+// validFeatures checks the dependencies between features
+func validFeatures(features uint64) bool {
+	has := func(feature uint64) bool { return features&feature != 0 }
+	switch {
+	case has(sdk.FeatureObjectMap) && !has(sdk.FeatureExclusiveLock):
+		return false
+	case has(sdk.FeatureFastDiff) && !has(sdk.FeatureObjectMap):
+		return false
+	case has(sdk.FeatureJournaling) && !has(sdk.FeatureExclusiveLock):
+		return false
+	}
+	return true
+}
+
+func (img *image) lookupSnap(name string) *snapshot {
+	for _, snap := range img.snaps {
+		if snap.name == name {
+			return snap
+		}
+	}
+	return nil
+}
+
+// volume is an opened image, snap is set if a snapshot was opened read-only
+type volume struct {
+	client *CephClient
+	image  *image
+	snap   *snapshot
+}
+
+// readOnly fails like librbd for changes of opened snapshots
+func (v *volume) readOnly() error {
+	if v.snap != nil {
+		return rbdError(syscall.EROFS)
+	}
+	return nil
+}
+
+func (v *volume) Close() error {
+	return nil
+}
+
+func (v *volume) GetParent() (string, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	parent := v.image.parent
+	if parent == nil {
+		return "", nil
+	}
+	base := parent.image
+	return v.client.imageID(base) + "@" + parent.name, nil
+}
+
+func (v *volume) GetParentInfo() (*sdk.ParentInfo, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	parent := v.image.parent
+	if parent == nil {
+		return nil, nil
+	}
+	base := parent.image
+	return &sdk.ParentInfo{
+		Pool:      base.pool.name,
+		Namespace: base.namespace,
+		Image:     base.name,
+		Snapshot:  parent.name,
+		Overlap:   v.image.overlap,
+	}, nil
+}
+
+func (v *volume) GetSize() (uint64, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if v.snap != nil {
+		return v.snap.size, nil
+	}
+	return v.image.size, nil
+}
+
+func (v *volume) GetDataPool() (string, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	return v.image.dataPool, nil
+}
+
+func (v *volume) GetObjectSize() (uint64, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	return uint64(1) << v.image.order, nil
+}
+
+func (v *volume) GetStripeUnit() (uint64, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	return v.image.stripeUnit, nil
+}
+
+func (v *volume) GetStripeCount() (uint64, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	return v.image.stripeCount, nil
+}
+
+func (v *volume) GetFeatures() (uint64, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	return v.image.features, nil
+}
+
+// UpdateFeatures fails like librbd for immutable features or if the
+// dependencies between features would be broken
+func (v *volume) UpdateFeatures(features uint64, enabled bool) error {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	mutable := mutableFeatures
+	if !enabled {
+		mutable |= sdk.FeatureDeepFlatten
+	}
+	if features&^mutable != 0 {
+		return rbdError(syscall.EINVAL)
+	}
+	newFeatures := v.image.features | features
+	if !enabled {
+		newFeatures = v.image.features &^ features
+	}
+	if !validFeatures(newFeatures) {
+		return rbdError(syscall.EINVAL)
+	}
+	v.image.features = newFeatures
+	return nil
+}
+
+func (v *volume) Resize(size uint64) error {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if err := v.readOnly(); err != nil {
+		return err
+	}
+	v.image.size = size
+	v.image.data.truncate(size)
+	if v.image.overlap > size {
+		v.image.overlap = size
+	}
+	return nil
+}
+
+// ReadAt reads like rbd_read, reads beyond the size are short
+func (v *volume) ReadAt(p []byte, off int64) (int, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	size, data := v.image.size, v.image.data
+	if v.snap != nil {
+		size, data = v.snap.size, v.snap.data
+	}
+	if uint64(off) >= size {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if uint64(off)+uint64(n) > size {
+		n = int(size - uint64(off))
+	}
+	data.readAt(p[:n], uint64(off))
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt writes like rbd_write, writes beyond the size fail
+func (v *volume) WriteAt(p []byte, off int64) (int, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if err := v.readOnly(); err != nil {
+		return 0, err
+	}
+	if uint64(off)+uint64(len(p)) > v.image.size {
+		return 0, rbdError(syscall.EINVAL)
+	}
+	v.image.data.writeAt(p, uint64(off))
+	return len(p), nil
+}
+
+// GetAllocatedExtents returns the written ranges of the image or snapshot
+func (v *volume) GetAllocatedExtents() ([]sdk.Extent, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if v.snap != nil {
+		return v.snap.data.extents(v.snap.size), nil
+	}
+	return v.image.data.extents(v.image.size), nil
+}
+
+func (v *volume) LookupSnapByName(name string) (sdk.CephSnapshotI, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	snap := v.image.lookupSnap(name)
+	if snap == nil {
+		return nil, nil
+	}
+	return &snapshotHandle{client: v.client, snapshot: snap}, nil
+}
+
+func (v *volume) CreateSnapshot(name string) (sdk.CephSnapshotI, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if err := v.readOnly(); err != nil {
+		return nil, err
+	}
+	if v.image.lookupSnap(name) != nil {
+		return nil, rbdError(syscall.EEXIST)
+	}
+	snap := &snapshot{image: v.image, name: name, size: v.image.size, data: v.image.data.clone()}
+	v.image.snaps = append(v.image.snaps, snap)
+	return &snapshotHandle{client: v.client, snapshot: snap}, nil
+}
+
+// Flatten detaches the image from its parent, fails without parent
+func (v *volume) Flatten(ctx context.Context) error {
+	if err := v.client.wait(ctx); err != nil {
+		return err
+	}
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if v.image.parent == nil {
+		return rbdError(syscall.EINVAL)
+	}
+	v.image.parent = nil
+	v.image.overlap = 0
+	return nil
+}
+
+// ListChildren returns the ids of the clones of all snapshots of the image
+func (v *volume) ListChildren() ([]string, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	return v.client.imageChildIDs(v.image), nil
+}
+
+// ListMetadata returns a copy of the metadata of the image
+func (v *volume) ListMetadata() (map[string]string, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	return copyMetadata(v.image.metadata), nil
+}
+
+func (v *volume) SetMetadata(key, value string) error {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if err := v.readOnly(); err != nil {
+		return err
+	}
+	if v.image.metadata == nil {
+		v.image.metadata = make(map[string]string)
+	}
+	v.image.metadata[key] = value
+	return nil
+}
+
+// RemoveMetadata fails like librbd for missing keys
+func (v *volume) RemoveMetadata(key string) error {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if err := v.readOnly(); err != nil {
+		return err
+	} else if _, ok := v.image.metadata[key]; !ok {
+		return rbdError(syscall.ENOENT)
+	}
+	delete(v.image.metadata, key)
+	return nil
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	ret := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		ret[k] = v
+	}
+	return ret
+}
+
+// snapshotHandle is a snapshot of an opened image
+type snapshotHandle struct {
+	client   *CephClient
+	snapshot *snapshot
+}
+
+// Remove unprotects the snapshot like sdk.CephSnapshot, snapshots with
+// children are not removed
+func (s *snapshotHandle) Remove() error {
+	s.client.lock.Lock()
+	defer s.client.lock.Unlock()
+
+	if children := s.client.childIDs(s.snapshot); len(children) > 0 {
+		return &sdk.ChildrenError{Parent: s.client.imageID(s.snapshot.image) + "@" + s.snapshot.name, Children: children}
+	}
+	s.snapshot.protected = false
+	img := s.snapshot.image
+	for i, snap := range img.snaps {
+		if snap == s.snapshot {
+			img.snaps = append(img.snaps[:i], img.snaps[i+1:]...)
+			return nil
+		}
+	}
+	return errImageNotFound
+}
+
+func (s *snapshotHandle) IsProtected() (bool, error) {
+	s.client.lock.Lock()
+	defer s.client.lock.Unlock()
+
+	return s.snapshot.protected, nil
+}
+
+func (s *snapshotHandle) Protect() error {
+	s.client.lock.Lock()
+	defer s.client.lock.Unlock()
+
+	if s.snapshot.protected {
+		return rbdError(syscall.EBUSY)
+	}
+	s.snapshot.protected = true
+	return nil
+}
+
+// ListChildren returns the ids of the clones of the snapshot
+func (s *snapshotHandle) ListChildren() ([]string, error) {
+	s.client.lock.Lock()
+	defer s.client.lock.Unlock()
+
+	return s.client.childIDs(s.snapshot), nil
+}
+
+// Unprotect fails while the snapshot has children
+func (s *snapshotHandle) Unprotect() error {
+	s.client.lock.Lock()
+	defer s.client.lock.Unlock()
+
+	if !s.snapshot.protected {
+		return rbdError(syscall.EINVAL)
+	}
+	if len(s.client.children(s.snapshot)) > 0 {
+		return rbdError(syscall.EBUSY)
+	}
+	s.snapshot.protected = false
+	return nil
+}
+
+func (s *snapshotHandle) Rollback(ctx context.Context) error {
+	if err := s.client.wait(ctx); err != nil {
+		return err
+	}
+	s.client.lock.Lock()
+	defer s.client.lock.Unlock()
+
+	s.snapshot.image.size = s.snapshot.size
+	s.snapshot.image.data = s.snapshot.data.clone()
+	return nil
+}
+
+// GetMirrorMode returns none unless SetMirrorMode was called
+func (c *CephClient) GetMirrorMode(name string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(name)
+	if err != nil {
+		return "", err
+	} else if p.mirrorMode == "" {
+		return sdk.MirrorModeNone, nil
+	}
+	return p.mirrorMode, nil
+}
+
+// SetMirrorMode fails like librbd when mirroring is disabled while images
+// are still mirrored, and like cls_rbd while peers are still registered
+func (c *CephClient) SetMirrorMode(name, mode string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(name)
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case sdk.MirrorModeNone:
+		for _, img := range p.images {
+			if img.mirror != nil {
+				return rbdError(syscall.EINVAL)
+			}
+		}
+		if len(p.mirrorPeers) > 0 {
+			return rbdError(syscall.EBUSY)
+		}
+	case sdk.MirrorModePool, sdk.MirrorModeImage:
+	default:
+		return rbdError(syscall.EINVAL)
+	}
+	p.mirrorMode = mode
+	return nil
+}
+
+// GetMirrorSiteName returns the fsid, the default site name of librbd
+func (c *CephClient) GetMirrorSiteName(name string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, err := c.getPool(name); err != nil {
+		return "", err
+	}
+	return c.fsid, nil
+}
+
+// bootstrapToken is the decoded bootstrap token of a peer site
+type bootstrapToken struct {
+	FSID     string `json:"fsid"`
+	ClientID string `json:"client_id"`
+	Key      string `json:"key"`
+	MonHost  string `json:"mon_host"`
+}
+
+// CreateMirrorPeerBootstrap returns a token of the format of librbd, the
+// user client.rbd-mirror-peer is created if needed
+func (c *CephClient) CreateMirrorPeerBootstrap(name string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, err := c.getPool(name); err != nil {
+		return "", err
+	}
+	u, ok := c.users["rbd-mirror-peer"]
+	if !ok {
+		var err error
+		caps := map[string]string{"mon": "profile rbd-mirror-peer", "osd": "profile rbd"}
+		if u, err = c.newUser("rbd-mirror-peer", caps); err != nil {
+			return "", err
+		}
+	}
+	token, err := json.Marshal(&bootstrapToken{FSID: c.fsid, ClientID: "rbd-mirror-peer", Key: u.key, MonHost: strings.Join(c.Mons, ",")})
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(token), nil
+}
+
+// ImportMirrorPeerBootstrap adds the cluster of the token as peer, the site
+// name of the peer is its fsid as the remote cluster isn't contacted
+func (c *CephClient) ImportMirrorPeerBootstrap(name, direction, token string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(name)
+	if err != nil {
+		return err
+	} else if p.mirrorMode == "" || p.mirrorMode == sdk.MirrorModeNone {
+		return rbdError(syscall.EINVAL)
+	} else if direction != sdk.MirrorPeerRxOnly && direction != sdk.MirrorPeerRxTx {
+		return rbdError(syscall.EINVAL)
+	}
+	buf, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return rbdError(syscall.EINVAL)
+	}
+	var t bootstrapToken
+	if err = json.Unmarshal(buf, &t); err != nil || t.FSID == "" || t.ClientID == "" || t.Key == "" {
+		return rbdError(syscall.EINVAL)
+	} else if t.FSID == c.fsid {
+		// a cluster can't be its own peer
+		return rbdError(syscall.EINVAL)
+	}
+	for i := range p.mirrorPeers {
+		if p.mirrorPeers[i].SiteName == t.FSID {
+			p.mirrorPeers[i].Direction = direction
+			return nil
+		}
+	}
+	p.mirrorPeers = append(p.mirrorPeers, sdk.MirrorPeer{
+		UUID:       newUUID(),
+		SiteName:   t.FSID,
+		ClientName: "client." + t.ClientID,
+		Direction:  direction,
+	})
+	return nil
+}
+
+func (c *CephClient) ListMirrorPeers(name string) ([]sdk.MirrorPeer, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(name)
+	if err != nil {
+		return nil, err
+	}
+	return append([]sdk.MirrorPeer(nil), p.mirrorPeers...), nil
+}
+
+func (c *CephClient) RemoveMirrorPeer(name, uuid string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, err := c.getPool(name)
+	if err != nil {
+		return err
+	}
+	for i := range p.mirrorPeers {
+		if p.mirrorPeers[i].UUID == uuid {
+			p.mirrorPeers = append(p.mirrorPeers[:i], p.mirrorPeers[i+1:]...)
+			return nil
+		}
+	}
+	return rbdError(syscall.ENOENT)
+}
+
+func (v *volume) GetMirrorInfo() (*sdk.MirrorImageInfo, error) {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if v.image.mirror == nil {
+		return &sdk.MirrorImageInfo{State: sdk.MirrorImageDisabled}, nil
+	}
+	info := *v.image.mirror
+	return &info, nil
+}
+
+// EnableMirroring fails like librbd unless the pool is in image mode, journal
+// mode requires the journaling feature
+func (v *volume) EnableMirroring(mode string) error {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if err := v.readOnly(); err != nil {
+		return err
+	} else if v.image.pool.mirrorMode != sdk.MirrorModeImage {
+		return rbdError(syscall.EINVAL)
+	} else if v.image.mirror != nil {
+		return nil
+	}
+	switch mode {
+	case sdk.MirrorImageModeJournal:
+		if v.image.features&sdk.FeatureJournaling == 0 {
+			return rbdError(syscall.EINVAL)
+		}
+	case sdk.MirrorImageModeSnapshot:
+	default:
+		return rbdError(syscall.EINVAL)
+	}
+	v.image.mirror = &sdk.MirrorImageInfo{Mode: mode, State: sdk.MirrorImageEnabled, GlobalID: newUUID(), Primary: true}
+	return nil
+}
+
+// DisableMirroring fails like librbd for non-primary images without force
+func (v *volume) DisableMirroring(force bool) error {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if err := v.readOnly(); err != nil {
+		return err
+	} else if v.image.mirror == nil {
+		return nil
+	} else if !v.image.mirror.Primary && !force {
+		return rbdError(syscall.EINVAL)
+	}
+	v.image.mirror = nil
+	return nil
+}
+
+// PromoteMirrorImage fails like librbd for primary images, the peer's copy
+// isn't modeled, so force makes no difference
+func (v *volume) PromoteMirrorImage(force bool) error {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if v.image.mirror == nil || v.image.mirror.Primary {
+		return rbdError(syscall.EINVAL)
+	}
+	v.image.mirror.Primary = true
+	return nil
+}
+
+// DemoteMirrorImage fails like librbd for non-primary images
+func (v *volume) DemoteMirrorImage() error {
+	v.client.lock.Lock()
+	defer v.client.lock.Unlock()
+
+	if v.image.mirror == nil || !v.image.mirror.Primary {
+		return rbdError(syscall.EINVAL)
+	}
+	v.image.mirror.Primary = false
+	return nil
+}
@@ -0,0 +1,57 @@
+package sdk
+
+// image features, the bits and names of librbd
+const (
+	FeatureLayering      uint64 = 1 << 0
+	FeatureStripingV2    uint64 = 1 << 1
+	FeatureExclusiveLock uint64 = 1 << 2
+	FeatureObjectMap     uint64 = 1 << 3
+	FeatureFastDiff      uint64 = 1 << 4
+	FeatureDeepFlatten   uint64 = 1 << 5
+	FeatureJournaling    uint64 = 1 << 6
+	FeatureDataPool      uint64 = 1 << 7
+
+	FeatureNameLayering      = "layering"
+	FeatureNameStripingV2    = "striping"
+	FeatureNameExclusiveLock = "exclusive-lock"
+	FeatureNameObjectMap     = "object-map"
+	FeatureNameFastDiff      = "fast-diff"
+	FeatureNameDeepFlatten   = "deep-flatten"
+	FeatureNameJournaling    = "journaling"
+	FeatureNameDataPool      = "data-pool"
+)
+
+var featureNames = map[string]uint64{
+	FeatureNameLayering:      FeatureLayering,
+	FeatureNameStripingV2:    FeatureStripingV2,
+	FeatureNameExclusiveLock: FeatureExclusiveLock,
+	FeatureNameObjectMap:     FeatureObjectMap,
+	FeatureNameFastDiff:      FeatureFastDiff,
+	FeatureNameDeepFlatten:   FeatureDeepFlatten,
+	FeatureNameJournaling:    FeatureJournaling,
+	FeatureNameDataPool:      FeatureDataPool,
+}
+
+// FeatureSet is a bitmask of image features like rbd.FeatureSet of go-ceph,
+// which needs cgo
+type FeatureSet uint64
+
+// FeatureSetFromNames returns the features of names, unknown ones are ignored
+func FeatureSetFromNames(names []string) FeatureSet {
+	var fs FeatureSet
+	for _, name := range names {
+		fs |= FeatureSet(featureNames[name])
+	}
+	return fs
+}
+
+// Names returns the names of the features in fs, unknown ones are left out
+func (fs FeatureSet) Names() []string {
+	names := []string{}
+	for name, bit := range featureNames {
+		if uint64(fs)&bit == bit {
+			names = append(names, name)
+		}
+	}
+	return names
+}
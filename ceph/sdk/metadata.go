@@ -0,0 +1,5 @@
+package sdk
+
+// ConfMetadataPrefix prefixes the metadata keys of the config overrides of an
+// image or pool, which `rbd config image set` and `rbd config pool set` write
+const ConfMetadataPrefix = "conf_"
@@ -0,0 +1,50 @@
+package sdk
+
+// mirror modes of pools
+const (
+	MirrorModeNone  = "none"
+	MirrorModePool  = "pool"
+	MirrorModeImage = "image"
+)
+
+// mirror modes of images
+const (
+	MirrorImageModeJournal  = "journal"
+	MirrorImageModeSnapshot = "snapshot"
+)
+
+// mirror states of images
+const (
+	MirrorImageEnabled   = "enabled"
+	MirrorImageDisabling = "disabling"
+	MirrorImageDisabled  = "disabled"
+)
+
+// directions of mirror peers
+const (
+	MirrorPeerRxOnly = "rx-only"
+	MirrorPeerTxOnly = "tx-only"
+	MirrorPeerRxTx   = "rx-tx"
+)
+
+// MirrorPeer is a peer site of a mirrored pool
+type MirrorPeer struct {
+	UUID       string
+	SiteName   string
+	ClientName string
+	Direction  string
+}
+
+// MirrorImageInfo is the mirroring state of an image
+type MirrorImageInfo struct {
+	// Mode is empty unless mirroring is enabled
+	Mode     string
+	State    string
+	GlobalID string
+	Primary  bool
+}
+
+// Enabled reports if the image is mirrored
+func (i *MirrorImageInfo) Enabled() bool {
+	return i.State == MirrorImageEnabled
+}
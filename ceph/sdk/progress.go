@@ -0,0 +1,67 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// progressInterval is the minimum interval between two progress logs of a
+// long running operation
+var progressInterval = 10 * time.Second
+
+// Progress logs the progress of a long running operation like flatten, the
+// operation is aborted once ctx is done
+type Progress struct {
+	ctx  context.Context
+	op   string
+	lock sync.Mutex
+	last time.Time
+}
+
+// NewProgress returns the progress of op, logged from now on
+func NewProgress(ctx context.Context, op string) *Progress {
+	return &Progress{ctx: ctx, op: op, last: time.Now()}
+}
+
+// Update logs the progress at most every progressInterval, it returns false
+// if the operation should be aborted
+func (p *Progress) Update(offset, total uint64) bool {
+	if p.ctx.Err() != nil {
+		return false
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if time.Since(p.last) < progressInterval {
+		return true
+	}
+	p.last = time.Now()
+	if total > 0 {
+		logrus.Infof("%s: %d%% done", p.op, offset*100/total)
+	} else {
+		logrus.Infof("%s: still running", p.op)
+	}
+	return true
+}
+
+// RunWithProgress runs op and logs its progress, the progress callback of
+// librbd aborts op once ctx is done. The images of op stay in use until
+// librbd returns, which is after the objects in flight are done.
+func RunWithProgress(ctx context.Context, name string, op func(p *Progress) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	start := time.Now()
+	logrus.Infof("%s ...", name)
+	if err := op(NewProgress(ctx, name)); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("aborted after %s: %v", time.Since(start).Round(time.Second), ctx.Err())
+		}
+		return err
+	}
+	logrus.Infof("%s done in %s", name, time.Since(start).Round(time.Second))
+	return nil
+}
@@ -0,0 +1,16 @@
+package sdk
+
+import "fmt"
+
+// UnsupportedError is returned by calls which need a newer librbd than the
+// ceph release the provider is built for, see the build tags in README.md
+type UnsupportedError struct {
+	// Feature is what was asked for, e.g. "rbd namespaces"
+	Feature string
+	// Release is the first ceph release with it
+	Release string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s requires ceph %s or later, the provider is built for an older release", e.Feature, e.Release)
+}
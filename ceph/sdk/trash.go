@@ -0,0 +1,25 @@
+package sdk
+
+import (
+	"sort"
+	"time"
+)
+
+// TrashEntry is an image in the rbd trash of a pool
+type TrashEntry struct {
+	ID           string
+	Name         string
+	DeletionTime time.Time
+	// DeferredUntil is the time before which the image can't be purged
+	DeferredUntil time.Time
+}
+
+// SortTrash sorts trash entries by deletion time and id
+func SortTrash(entries []TrashEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].DeletionTime.Equal(entries[j].DeletionTime) {
+			return entries[i].DeletionTime.Before(entries[j].DeletionTime)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+}
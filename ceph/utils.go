@@ -2,6 +2,7 @@ package ceph
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"reflect"
@@ -11,6 +12,8 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/gofrs/uuid"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -107,3 +110,73 @@ func InSlice(x interface{}, y interface{}) bool {
 	}
 	return false
 }
+
+// expandStringSet converts a set of strings of the schema to a slice
+func expandStringSet(set *schema.Set) []string {
+	ret := make([]string, 0, set.Len())
+	for _, v := range set.List() {
+		ret = append(ret, v.(string))
+	}
+	return ret
+}
+
+// dataSourceSchemaFromResource copies the schema of a resource with all
+// attributes computed, args are then made required or optional by the caller
+func dataSourceSchemaFromResource(rs map[string]*schema.Schema, skip ...string) map[string]*schema.Schema {
+	ds := make(map[string]*schema.Schema, len(rs))
+	for k, v := range rs {
+		if InSlice(k, skip) {
+			continue
+		}
+		attr := &schema.Schema{
+			Type:        v.Type,
+			Computed:    true,
+			Sensitive:   v.Sensitive,
+			Description: v.Description,
+		}
+		if elem, ok := v.Elem.(*schema.Schema); ok {
+			attr.Elem = &schema.Schema{Type: elem.Type}
+		} else if elem, ok := v.Elem.(*schema.Resource); ok {
+			attr.Elem = &schema.Resource{Schema: dataSourceSchemaFromResource(elem.Schema)}
+		}
+		ds[k] = attr
+	}
+	return ds
+}
+
+// diagsErr returns the first error of diags
+func diagsErr(diags diag.Diagnostics) error {
+	for _, d := range diags {
+		if d.Severity == diag.Error {
+			return fmt.Errorf("%s %s", d.Summary, d.Detail)
+		}
+	}
+	return nil
+}
+
+// parseClusterID parses ids like {cluster}/{name}
+func parseClusterID(id, kind, field string) (cluster string, name string, err error) {
+	path := strings.Split(id, "/")
+	if len(path) != 2 || path[0] == "" || path[1] == "" {
+		return "", "", fmt.Errorf("invalid %s id '%s', correct: {cluster_name}/{%s}", kind, id, field)
+	}
+	return path[0], path[1], nil
+}
+
+// normalizeImportID trims spaces and leading or trailing slashes of an id
+// given to `terraform import`
+func normalizeImportID(id string) string {
+	return strings.Trim(strings.TrimSpace(id), "/")
+}
+
+// importByRead reads the resource with its normalized id, importing fails
+// if it doesn't exist instead of leaving an empty state behind
+func importByRead(ctx context.Context, d *schema.ResourceData, meta interface{}, kind, id string, read schema.ReadContextFunc) ([]*schema.ResourceData, error) {
+	d.SetId(id)
+	if err := diagsErr(read(ctx, d, meta)); err != nil {
+		return nil, err
+	} else if d.Id() == "" {
+		return nil, fmt.Errorf("%s '%s' not found", kind, id)
+	}
+	return []*schema.ResourceData{d}, nil
+}
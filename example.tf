@@ -9,7 +9,9 @@ terraform {
 }
 
 provider "ceph" {
-  cluster = "ceph"
+  cluster {
+    name = "ceph"
+  }
 }
 
 resource "ceph_mon" "mon-ceph" {
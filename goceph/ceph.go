@@ -0,0 +1,1180 @@
+package goceph
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"terraform-provider-ceph/ceph/helper/mutexkv"
+	"terraform-provider-ceph/ceph/helper/utils"
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ceph/go-ceph/rbd"
+	"github.com/sirupsen/logrus"
+)
+
+type CephSnapshot struct {
+	volume *CephVolume
+	name   string
+	*rbd.Snapshot
+	*rbd.Image
+	Ioctx *rados.IOContext
+}
+
+// Rollback rolls the volume back to the snapshot, ctx aborts it
+func (s *CephSnapshot) Rollback(ctx context.Context) error {
+	return sdk.RunWithProgress(ctx, fmt.Sprintf("rollback image '%s' to snapshot '%s'", s.volume.id(), s.name), func(p *sdk.Progress) error {
+		return rbdSnapRollback(s.Ioctx, s.volume.name, s.name, p)
+	})
+}
+
+// Remove unprotects and removes the snapshot, it fails with an sdk.ChildrenError
+// while the snapshot has clones
+func (s *CephSnapshot) Remove() error {
+	return s.volume.waitCall(s.remove)
+}
+
+// IsProtected returns whether the snapshot is protected
+func (s *CephSnapshot) IsProtected() (bool, error) {
+	var protected bool
+	var err error
+	if waitErr := s.volume.wait(func() {
+		protected, err = s.Snapshot.IsProtected()
+	}); waitErr != nil {
+		return false, waitErr
+	}
+	return protected, err
+}
+
+// Protect protects the snapshot, so that it can be cloned
+func (s *CephSnapshot) Protect() error {
+	return s.volume.waitCall(s.Snapshot.Protect)
+}
+
+// Unprotect unprotects the snapshot, it fails while it has clones
+func (s *CephSnapshot) Unprotect() error {
+	return s.volume.waitCall(s.Snapshot.Unprotect)
+}
+
+func (s *CephSnapshot) remove() error {
+	children, err := s.listChildren()
+	if err != nil {
+		return err
+	} else if len(children) > 0 {
+		return &sdk.ChildrenError{Parent: s.volume.id() + "@" + s.name, Children: children}
+	}
+	if protected, err := s.Snapshot.IsProtected(); err != nil {
+		return err
+	} else if protected {
+		if err = s.Snapshot.Unprotect(); err != nil {
+			return err
+		}
+	}
+	return s.Snapshot.Remove()
+}
+
+type CephVolume struct {
+	cluster   string
+	pool      string
+	namespace string
+	name      string
+	conn      *rados.Conn
+	*rbd.Image
+	Ioctx *rados.IOContext
+	// ctx of the client which opened the volume, see wait
+	ctx context.Context
+	// lock guards calls and closed
+	lock sync.Mutex
+	// calls is the number of calls in the background, see wait
+	calls int
+	// closed is set by Close while calls are left, the last one closes
+	// the image
+	closed bool
+}
+
+// id returns {cluster}/{pool}/[{namespace}/]{name} of the volume
+func (v *CephVolume) id() string {
+	return sdk.FormatCephVol(v.cluster, v.pool, v.namespace, v.name)
+}
+
+// wait is CephClient.wait for calls on the image, which stays open until
+// the calls given up on have returned
+func (v *CephVolume) wait(fn func()) error {
+	if err := v.ctx.Err(); err != nil {
+		return err
+	}
+	v.lock.Lock()
+	v.calls++
+	v.lock.Unlock()
+	if err := waitContext(v.ctx, func() {
+		defer v.done()
+		fn()
+	}); err != nil {
+		return fmt.Errorf("image '%s': %w", v.id(), err)
+	}
+	return nil
+}
+
+// waitCall is wait for fn returning an error
+func (v *CephVolume) waitCall(fn func() error) error {
+	var err error
+	if waitErr := v.wait(func() {
+		err = fn()
+	}); waitErr != nil {
+		return waitErr
+	}
+	return err
+}
+
+// done ends a call of wait, the image is closed after the last call if
+// Close was called meanwhile
+func (v *CephVolume) done() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.calls--
+	if v.calls == 0 && v.closed {
+		_ = v.close()
+	}
+}
+
+// parentSpec is the parent snapshot of a clone
+type parentSpec struct {
+	pool      string
+	namespace string
+	image     string
+	snap      string
+}
+
+// GetParentInfo returns the parent snapshot of the image, nil if the image
+// isn't a clone. It replaces GetParentInfo of go-ceph, which truncates names
+// to its fixed size buffers.
+func (v *CephVolume) GetParentInfo() (*sdk.ParentInfo, error) {
+	var info *sdk.ParentInfo
+	var err error
+	if waitErr := v.wait(func() {
+		var parent *parentSpec
+		if parent, err = rbdGetParent(v.Ioctx, v.name); err != nil || parent == nil {
+			return
+		}
+		var overlap uint64
+		if overlap, err = v.Image.GetOverlap(); err != nil {
+			return
+		}
+		info = &sdk.ParentInfo{
+			Pool:      parent.pool,
+			Namespace: parent.namespace,
+			Image:     parent.image,
+			Snapshot:  parent.snap,
+			Overlap:   overlap,
+		}
+	}); waitErr != nil {
+		return nil, waitErr
+	}
+	return info, err
+}
+
+// GetParent returns the id of the parent snapshot, empty if the image isn't a clone
+func (v *CephVolume) GetParent() (string, error) {
+	parent, err := v.GetParentInfo()
+	if err != nil || parent == nil {
+		return "", err
+	}
+	return sdk.FormatCephVol(v.cluster, parent.Pool, parent.Namespace, parent.Image) + "@" + parent.Snapshot, nil
+}
+
+// GetDataPool returns the pool of the image data, empty if it's stored with
+// the metadata. librbd keeps the pool id in the omap of the image header.
+func (v *CephVolume) GetDataPool() (string, error) {
+	var pool string
+	var err error
+	if waitErr := v.wait(func() {
+		pool, err = v.getDataPool()
+	}); waitErr != nil {
+		return "", waitErr
+	}
+	return pool, err
+}
+
+func (v *CephVolume) getDataPool() (string, error) {
+	features, err := v.Image.GetFeatures()
+	if err != nil {
+		return "", err
+	} else if features&rbd.FeatureDataPool == 0 {
+		return "", nil
+	}
+	id, err := v.Image.GetId()
+	if err != nil {
+		return "", err
+	}
+	vals, err := v.Ioctx.GetOmapValues("rbd_header."+id, "", "data_pool_id", 1)
+	if err != nil {
+		return "", err
+	}
+	val, ok := vals["data_pool_id"]
+	if !ok || len(val) != 8 {
+		return "", fmt.Errorf("data pool of image not found in header rbd_header.%s", id)
+	}
+	poolID := int64(binary.LittleEndian.Uint64(val))
+	if poolID < 0 {
+		return "", nil
+	}
+	return v.conn.GetPoolByID(poolID)
+}
+
+// GetObjectSize returns the object size of the image in bytes
+func (v *CephVolume) GetObjectSize() (uint64, error) {
+	var info *rbd.ImageInfo
+	var err error
+	if waitErr := v.wait(func() {
+		info, err = v.Image.Stat()
+	}); waitErr != nil {
+		return 0, waitErr
+	} else if err != nil {
+		return 0, err
+	}
+	return info.Obj_size, nil
+}
+
+// waitUint64 is wait for calls of the image returning a number
+func (v *CephVolume) waitUint64(fn func() (uint64, error)) (uint64, error) {
+	var n uint64
+	var err error
+	if waitErr := v.wait(func() {
+		n, err = fn()
+	}); waitErr != nil {
+		return 0, waitErr
+	}
+	return n, err
+}
+
+// GetSize returns the size of the image in bytes
+func (v *CephVolume) GetSize() (uint64, error) {
+	return v.waitUint64(v.Image.GetSize)
+}
+
+// GetStripeUnit returns the stripe unit of the image in bytes
+func (v *CephVolume) GetStripeUnit() (uint64, error) {
+	return v.waitUint64(v.Image.GetStripeUnit)
+}
+
+// GetStripeCount returns the stripe count of the image
+func (v *CephVolume) GetStripeCount() (uint64, error) {
+	return v.waitUint64(v.Image.GetStripeCount)
+}
+
+// GetFeatures returns the feature bits of the image
+func (v *CephVolume) GetFeatures() (uint64, error) {
+	return v.waitUint64(v.Image.GetFeatures)
+}
+
+// UpdateFeatures enables or disables features of the image
+func (v *CephVolume) UpdateFeatures(features uint64, enabled bool) error {
+	return v.waitCall(func() error {
+		return v.Image.UpdateFeatures(features, enabled)
+	})
+}
+
+// Resize changes the size of the image in bytes
+func (v *CephVolume) Resize(size uint64) error {
+	return v.waitCall(func() error {
+		return v.Image.Resize(size)
+	})
+}
+
+// LookupSnapByName returns the snapshot of the image, nil if it's missing
+func (v *CephVolume) LookupSnapByName(name string) (sdk.CephSnapshotI, error) {
+	var snaps []rbd.SnapInfo
+	var err error
+	if waitErr := v.wait(func() {
+		snaps, err = v.Image.GetSnapshotNames()
+	}); waitErr != nil {
+		return nil, waitErr
+	} else if err != nil {
+		return nil, err
+	}
+	for _, snap := range snaps {
+		if snap.Name == name {
+			return &CephSnapshot{volume: v, name: name, Snapshot: v.Image.GetSnapshot(name), Image: v.Image, Ioctx: v.Ioctx}, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateSnapshot flushes the image and creates a snapshot of it
+func (v *CephVolume) CreateSnapshot(name string) (sdk.CephSnapshotI, error) {
+	var snapshot *rbd.Snapshot
+	var err error
+	if waitErr := v.wait(func() {
+		_ = v.Image.Flush()
+		snapshot, err = v.Image.CreateSnapshot(name)
+	}); waitErr != nil {
+		return nil, waitErr
+	} else if err != nil {
+		return nil, err
+	}
+	return &CephSnapshot{volume: v, name: name, Snapshot: snapshot, Image: v.Image, Ioctx: v.Ioctx}, nil
+}
+
+// Flatten copies the data of the parent into the volume, ctx aborts it
+func (v *CephVolume) Flatten(ctx context.Context) error {
+	_ = v.Image.Flush()
+	return sdk.RunWithProgress(ctx, fmt.Sprintf("flatten image '%s'", v.id()), func(p *sdk.Progress) error {
+		return rbdFlatten(v.Ioctx, v.name, p)
+	})
+}
+
+// Close closes the image, it's put off until the calls given up on have
+// returned
+func (v *CephVolume) Close() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.calls > 0 {
+		v.closed = true
+		return nil
+	}
+	return v.close()
+}
+
+func (v *CephVolume) close() error {
+	if v.Ioctx != nil {
+		defer v.Ioctx.Destroy()
+	}
+	return v.Image.Close()
+}
+
+var _ sdk.CephClientI = (*CephClient)(nil)
+
+// CephClient ceph
+type CephClient struct {
+	*rados.Conn
+	cluster string
+	MutexKV *mutexkv.MutexKV
+	// ctx of the calls, see WithContext
+	ctx context.Context
+}
+
+type monAttr struct {
+	Addr string `json:"addr"`
+}
+
+type monMap struct {
+	Mons []monAttr `json:"mons"`
+}
+
+// MonStat struct for output of ceph quorum_status
+type MonStat struct {
+	Monmap monMap `json:"monmap"`
+}
+
+type authUser struct {
+	Entity string            `json:"entity"`
+	Key    string            `json:"key"`
+	Caps   map[string]string `json:"caps"`
+}
+
+// NewCephClient generate ceph client
+func NewCephClient(config *sdk.ConnConfig) (*CephClient, error) {
+	var err error
+	clusterName := config.Cluster
+	if clusterName == "" {
+		clusterName = "ceph"
+	}
+	user := config.User
+	if user == "" {
+		user = "admin"
+	}
+	cephClient, err := rados.NewConnWithClusterAndUser(clusterName, "client."+user)
+	if err != nil {
+		return nil, err
+	}
+	if config.ConfigPath != "" {
+		err = cephClient.ReadConfigFile(config.ConfigPath)
+	} else if config.MonHost == "" {
+		if config.Cluster == "" {
+			err = cephClient.ReadDefaultConfigFile()
+		} else {
+			err = cephClient.ReadConfigFile(fmt.Sprintf("/etc/ceph/%s.conf", config.Cluster))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	options := map[string]string{
+		"mon_host": config.MonHost,
+		"key":      config.Key,
+		"keyring":  config.Keyring,
+	}
+	for k, v := range config.ConfigOverrides {
+		options[k] = v
+	}
+	for k, v := range options {
+		if v == "" {
+			continue
+		}
+		if err = cephClient.SetConfigOption(k, v); err != nil {
+			return nil, fmt.Errorf("set config option %s of cluster %s failed: %v", k, clusterName, err)
+		}
+	}
+	if err := cephClient.Connect(); err != nil {
+		return nil, err
+	}
+
+	client := &CephClient{
+		Conn:    cephClient,
+		MutexKV: mutexkv.NewMutexKV(),
+		cluster: config.Cluster,
+		ctx:     context.Background(),
+	}
+	return client, nil
+}
+
+// WithContext returns a client on the same connection whose calls give up
+// when ctx is done, so do the calls of the volumes it opens except for the
+// ones of go-ceph like Resize, GetFeatures or the snapshot calls, which are
+// only bounded by rados_osd_op_timeout
+func (c *CephClient) WithContext(ctx context.Context) sdk.CephClientI {
+	client := *c
+	client.ctx = ctx
+	return &client
+}
+
+// waitContext runs fn in the background until it returns or ctx is done.
+// rados and rbd calls can't be canceled, fn keeps running in the background
+// in that case and may still take effect.
+func waitContext(ctx context.Context, fn func()) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait runs fn until it returns or the context of the client is done, fn
+// isn't run if it's done already
+func (c *CephClient) wait(fn func()) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	return waitContext(c.ctx, fn)
+}
+
+// withIOContext is wait for fn with an io context of the pool and namespace,
+// the io context is destroyed once fn returns
+func (c *CephClient) withIOContext(pool, namespace string, fn func(ioctx *rados.IOContext) error) error {
+	var err error
+	if waitErr := c.wait(func() {
+		var ioctx *rados.IOContext
+		if ioctx, err = c.openIOContext(pool, namespace); err != nil {
+			return
+		}
+		defer ioctx.Destroy()
+		err = fn(ioctx)
+	}); waitErr != nil {
+		return fmt.Errorf("pool '%s': %w", pool, waitErr)
+	}
+	return err
+}
+
+// waitVolume is wait for open, which opens an image, the image is closed in
+// the background if it's only opened after the context is done
+func (c *CephClient) waitVolume(open func() (*CephVolume, error)) (sdk.CephVolumeI, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		vol *CephVolume
+		err error
+	}
+	opened := make(chan result, 1)
+	go func() {
+		vol, err := open()
+		opened <- result{vol: vol, err: err}
+	}()
+	select {
+	case r := <-opened:
+		if r.vol == nil {
+			return nil, r.err
+		}
+		return r.vol, r.err
+	case <-c.ctx.Done():
+		go func() {
+			if r := <-opened; r.vol != nil {
+				_ = r.vol.Close()
+			}
+		}()
+		return nil, c.ctx.Err()
+	}
+}
+
+// rawMonCommand is Conn.MonCommand giving up when the context is done
+func (c *CephClient) rawMonCommand(command []byte) ([]byte, string, error) {
+	var buf []byte
+	var info string
+	var err error
+	if waitErr := c.wait(func() {
+		buf, info, err = c.Conn.MonCommand(command)
+	}); waitErr != nil {
+		return nil, "", fmt.Errorf("mon command %s: %w", command, waitErr)
+	}
+	return buf, info, err
+}
+
+// GetMutexKV returns the locks shared by resources of the cluster
+func (c *CephClient) GetMutexKV() *mutexkv.MutexKV {
+	return c.MutexKV
+}
+
+// Version of ceph
+func (c *CephClient) Version() (string, error) {
+	command, _ := json.Marshal(map[string]string{"prefix": "version"})
+	buf, _, err := c.rawMonCommand(command)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// RadosVersion version of rados
+func (c *CephClient) RadosVersion() string {
+	major, minor, patch := rados.Version()
+	return fmt.Sprintf("%v.%v.%v", major, minor, patch)
+}
+
+// RbdVersion version of rbd
+func (c *CephClient) RbdVersion() string {
+	major, minor, patch := rbd.Version()
+	return fmt.Sprintf("%v.%v.%v", major, minor, patch)
+}
+
+// GetMons get ceph mons
+func (c *CephClient) GetMons() (mons []string, err error) {
+	prefix := fmt.Sprintf("quorum_status")
+	logrus.Debugf("get ceph mons: ceph %s", prefix)
+	command, _ := json.Marshal(map[string]string{"prefix": prefix})
+	buf, _, err := c.rawMonCommand(command)
+	if err != nil {
+		return mons, err
+	}
+	var monStat MonStat
+	if err := json.Unmarshal(buf, &monStat); err != nil {
+		return mons, err
+	}
+	for _, i := range monStat.Monmap.Mons {
+		mons = append(mons, strings.SplitN(i.Addr, "/", 2)[0])
+	}
+	return mons, nil
+}
+
+// InitClientUser init client user auth for pool, rwx on the pools is added
+// to the existing caps of the user
+func (c *CephClient) InitClientUser(username string, pools ...string) (key string, err error) {
+	if err = c.MutexKV.LockContext(c.ctx, c.cluster); err != nil {
+		return "", err
+	}
+	defer c.MutexKV.Unlock(c.cluster)
+
+	user, err := c.GetClientUser(username)
+	if err != nil {
+		return "", err
+	} else if user == nil {
+		if user, err = c.CreateClientUser(username, nil); err != nil {
+			return "", err
+		}
+	}
+	if len(pools) == 0 {
+		return user.Key, nil
+	}
+
+	caps := make(map[string]string, len(user.Caps))
+	for k, v := range user.Caps {
+		caps[k] = v
+	}
+	if _, ok := caps["mon"]; !ok {
+		caps["mon"] = "allow r"
+	}
+	if _, ok := caps["osd"]; !ok {
+		caps["osd"] = "allow class-read object_prefix rbd_children"
+	}
+	for _, pool := range pools {
+		if strings.Contains(caps["osd"], "pool="+pool) {
+			continue
+		}
+		caps["osd"] += fmt.Sprintf(", allow rwx pool=%s", pool)
+	}
+	logrus.Debugf("set ceph auth: client.%s %v", username, caps)
+	if err = c.SetClientUserCaps(username, caps); err != nil {
+		return "", err
+	}
+	return user.Key, nil
+}
+
+// imageOptions converts config to librbd image options, the caller must
+// destroy them
+func imageOptions(config *sdk.VolumeConfig) (*rbd.ImageOptions, error) {
+	if config == nil {
+		config = &sdk.VolumeConfig{}
+	}
+	order := config.Order
+	if order == 0 {
+		order = 22
+	}
+	rio := rbd.NewRbdImageOptions()
+	opts := map[rbd.ImageOption]uint64{
+		rbd.ImageOptionOrder:       order,
+		rbd.ImageOptionFeatures:    config.Features,
+		rbd.ImageOptionStripeUnit:  config.StripeUnit,
+		rbd.ImageOptionStripeCount: config.StripeCount,
+	}
+	for option, val := range opts {
+		if val == 0 {
+			continue
+		}
+		if err := rio.SetUint64(option, val); err != nil {
+			rio.Destroy()
+			return nil, err
+		}
+	}
+	if config.DataPool != "" {
+		if err := rio.SetString(rbd.ImageOptionDataPool, config.DataPool); err != nil {
+			rio.Destroy()
+			return nil, err
+		}
+	}
+	return rio, nil
+}
+
+// openIOContext opens the pool with the namespace set, images outside
+// of the namespace aren't visible
+func (c *CephClient) openIOContext(pool, namespace string) (*rados.IOContext, error) {
+	if err := checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	ioctx, err := c.Conn.OpenIOContext(pool)
+	if err != nil {
+		return nil, err
+	}
+	ioctx.SetNamespace(namespace)
+	return ioctx, nil
+}
+
+func (c *CephClient) CloneImg(basePool, baseNamespace, baseName, baseSnap, pool, namespace, name string, config *sdk.VolumeConfig) (sdk.CephVolumeI, error) {
+	return c.waitVolume(func() (*CephVolume, error) {
+		return c.cloneImg(basePool, baseNamespace, baseName, baseSnap, pool, namespace, name, config)
+	})
+}
+
+func (c *CephClient) cloneImg(basePool, baseNamespace, baseName, baseSnap, pool, namespace, name string, config *sdk.VolumeConfig) (*CephVolume, error) {
+	ioctx, err := c.openIOContext(pool, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("can't get ioctx of pool '%s': %v", pool, err)
+	}
+	// defer ioctx.Destroy()
+
+	baseIoctx := ioctx
+	if basePool == "" {
+		basePool = pool
+	}
+	if basePool != pool || baseNamespace != namespace {
+		if baseIoctx, err = c.openIOContext(basePool, baseNamespace); err != nil {
+			ioctx.Destroy()
+			return nil, fmt.Errorf("can't get ioctx of pool '%s': %v", basePool, err)
+		}
+		defer baseIoctx.Destroy()
+	}
+
+	rio, err := imageOptions(config)
+	if err != nil {
+		ioctx.Destroy()
+		return nil, err
+	}
+	defer rio.Destroy()
+	// clones only get layering by default, like rbd_clone with features 1
+	features := rbd.FeatureLayering
+	if config != nil {
+		features |= config.Features
+	}
+	if err = rio.SetUint64(rbd.ImageOptionFeatures, features); err != nil {
+		ioctx.Destroy()
+		return nil, err
+	}
+
+	if err = rbd.CloneImage(baseIoctx, baseName, baseSnap, ioctx, name, rio); err != nil {
+		ioctx.Destroy()
+		return nil, fmt.Errorf("clone image '%s@%s' failed: %v", imageSpec(basePool, baseNamespace, baseName), baseSnap, err)
+	}
+	vol, err := rbd.OpenImage(ioctx, name, rbd.NoSnapshot)
+	if err != nil {
+		ioctx.Destroy()
+		return nil, err
+	}
+	return &CephVolume{Image: vol, Ioctx: ioctx, conn: c.Conn, cluster: c.cluster, pool: pool, namespace: namespace, name: name, ctx: c.ctx}, nil
+}
+
+// DeepCopyImg copies the image with its snapshots up to baseSnap, the copy
+// doesn't depend on the base image, ctx aborts it
+func (c *CephClient) DeepCopyImg(ctx context.Context, basePool, baseNamespace, baseName, baseSnap, pool, namespace, name string, config *sdk.VolumeConfig) (sdk.CephVolumeI, error) {
+	return c.waitVolume(func() (*CephVolume, error) {
+		return c.deepCopyImg(ctx, basePool, baseNamespace, baseName, baseSnap, pool, namespace, name, config)
+	})
+}
+
+func (c *CephClient) deepCopyImg(ctx context.Context, basePool, baseNamespace, baseName, baseSnap, pool, namespace, name string, config *sdk.VolumeConfig) (*CephVolume, error) {
+	ioctx, err := c.openIOContext(pool, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("can't get ioctx of pool '%s': %v", pool, err)
+	}
+	// defer ioctx.Destroy()
+
+	baseIoctx, err := c.openIOContext(basePool, baseNamespace)
+	if err != nil {
+		ioctx.Destroy()
+		return nil, fmt.Errorf("can't get ioctx of pool '%s': %v", basePool, err)
+	}
+	defer baseIoctx.Destroy()
+
+	op := fmt.Sprintf("deep copy image '%s@%s'", imageSpec(basePool, baseNamespace, baseName), baseSnap)
+	if err = sdk.RunWithProgress(ctx, op, func(p *sdk.Progress) error {
+		return rbdDeepCopy(baseIoctx, baseName, baseSnap, ioctx, name, config, p)
+	}); err != nil {
+		// the partial copy stays behind otherwise
+		if rmErr := rbd.RemoveImage(ioctx, name); rmErr != nil && rmErr != rbd.ErrNotFound {
+			logrus.Errorf("remove partial copy '%s' failed: %v", imageSpec(pool, namespace, name), rmErr)
+		}
+		ioctx.Destroy()
+		return nil, fmt.Errorf("%s failed: %v", op, err)
+	}
+	vol, err := rbd.OpenImage(ioctx, name, rbd.NoSnapshot)
+	if err != nil {
+		ioctx.Destroy()
+		return nil, err
+	}
+	return &CephVolume{Image: vol, Ioctx: ioctx, conn: c.Conn, cluster: c.cluster, pool: pool, namespace: namespace, name: name, ctx: c.ctx}, nil
+}
+
+func (c *CephClient) CreateVol(pool, namespace, name string, size uint64, config *sdk.VolumeConfig) (sdk.CephVolumeI, error) {
+	return c.waitVolume(func() (*CephVolume, error) {
+		return c.createVol(pool, namespace, name, size, config)
+	})
+}
+
+func (c *CephClient) createVol(pool, namespace, name string, size uint64, config *sdk.VolumeConfig) (*CephVolume, error) {
+	ioctx, err := c.openIOContext(pool, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("can't get ioctx of pool '%s': %v", pool, err)
+	}
+	// defer ioctx.Destroy()
+
+	rio, err := imageOptions(config)
+	if err != nil {
+		ioctx.Destroy()
+		return nil, err
+	}
+	defer rio.Destroy()
+
+	if err = rbd.CreateImage(ioctx, name, size, rio); err != nil {
+		ioctx.Destroy()
+		return nil, err
+	}
+	vol, err := rbd.OpenImage(ioctx, name, rbd.NoSnapshot)
+	if err != nil {
+		ioctx.Destroy()
+		return nil, err
+	}
+	return &CephVolume{Image: vol, Ioctx: ioctx, conn: c.Conn, cluster: c.cluster, pool: pool, namespace: namespace, name: name, ctx: c.ctx}, nil
+}
+
+func (c *CephClient) DeleteVol(pool, namespace, name string) error {
+	var err error
+	if waitErr := c.wait(func() {
+		err = c.deleteVol(pool, namespace, name)
+	}); waitErr != nil {
+		return fmt.Errorf("delete image '%s': %w", imageSpec(pool, namespace, name), waitErr)
+	}
+	return err
+}
+
+func (c *CephClient) deleteVol(pool, namespace, name string) error {
+	vol, err := c.lookupVol(pool, namespace, name)
+	if err != nil || vol == nil {
+		return err
+	}
+	defer vol.Ioctx.Destroy()
+
+	children, err := vol.listChildren()
+	if err != nil {
+		_ = vol.Image.Close()
+		return err
+	} else if len(children) > 0 {
+		_ = vol.Image.Close()
+		return &sdk.ChildrenError{Parent: vol.id(), Children: children}
+	}
+
+	// removing should fail while image is opened
+	_ = vol.Image.Close()
+	return vol.Remove()
+}
+
+func (c *CephClient) DeleteSnap(pool, namespace, name, snapName string) error {
+	var err error
+	if waitErr := c.wait(func() {
+		err = c.deleteSnap(pool, namespace, name, snapName)
+	}); waitErr != nil {
+		return fmt.Errorf("delete snapshot '%s@%s': %w", imageSpec(pool, namespace, name), snapName, waitErr)
+	}
+	return err
+}
+
+func (c *CephClient) deleteSnap(pool, namespace, name, snapName string) error {
+	vol, err := c.lookupVol(pool, namespace, name)
+	if err != nil || vol == nil {
+		return err
+	}
+	defer vol.Close()
+
+	snap, err := vol.LookupSnapByName(snapName)
+	if err != nil || snap == nil {
+		return err
+	}
+	return snap.(*CephSnapshot).remove()
+}
+
+// LookupVolByName opens the image, it returns nil if it doesn't exist
+func (c *CephClient) LookupVolByName(pool, namespace, name string) (sdk.CephVolumeI, error) {
+	return c.waitVolume(func() (*CephVolume, error) {
+		return c.lookupVol(pool, namespace, name)
+	})
+}
+
+func (c *CephClient) lookupVol(pool, namespace, name string) (*CephVolume, error) {
+	ioctx, err := c.openIOContext(pool, namespace)
+	if err != nil {
+		return nil, err
+	}
+	// defer ioctx.Destroy()
+
+	vol, err := rbd.OpenImage(ioctx, name, rbd.NoSnapshot)
+	if err == rbd.ErrNotFound {
+		ioctx.Destroy()
+		return nil, nil
+	} else if err != nil {
+		ioctx.Destroy()
+		return nil, err
+	}
+	return &CephVolume{Image: vol, Ioctx: ioctx, conn: c.Conn, cluster: c.cluster, pool: pool, namespace: namespace, name: name, ctx: c.ctx}, nil
+}
+
+// ListVols returns the image names of the namespace of pool
+func (c *CephClient) ListVols(pool, namespace string) ([]string, error) {
+	var names []string
+	err := c.withIOContext(pool, namespace, func(ioctx *rados.IOContext) (err error) {
+		names, err = rbd.GetImageNames(ioctx)
+		return err
+	})
+	return names, err
+}
+
+// ListRBDNamespaces returns the rbd namespaces of pool
+func (c *CephClient) ListRBDNamespaces(pool string) ([]string, error) {
+	var namespaces []string
+	err := c.withIOContext(pool, "", func(ioctx *rados.IOContext) (err error) {
+		namespaces, err = rbdNamespaceList(ioctx)
+		return err
+	})
+	return namespaces, err
+}
+
+// CreateRBDNamespace creates the rbd namespace like `rbd namespace create`
+func (c *CephClient) CreateRBDNamespace(pool, namespace string) error {
+	return c.withIOContext(pool, "", func(ioctx *rados.IOContext) error {
+		return rbdNamespaceCreate(ioctx, namespace)
+	})
+}
+
+// DeleteRBDNamespace removes the rbd namespace, it fails while there are images in it
+func (c *CephClient) DeleteRBDNamespace(pool, namespace string) error {
+	return c.withIOContext(pool, "", func(ioctx *rados.IOContext) error {
+		if err := rbdNamespaceRemove(ioctx, namespace); err != rbd.ErrNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+// imageSpec formats images like the rbd cli, {pool}/[{namespace}/]{image}
+func imageSpec(pool, namespace, name string) string {
+	if namespace == "" {
+		return pool + "/" + name
+	}
+	return pool + "/" + namespace + "/" + name
+}
+
+func (c *CephClient) ExistPool(name string) (bool, error) {
+	var err error
+	if waitErr := c.wait(func() {
+		_, err = c.Conn.GetPoolByName(name)
+	}); waitErr != nil {
+		return false, fmt.Errorf("lookup pool '%s': %w", name, waitErr)
+	}
+	if err == rados.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// monCommand run mon command, the status string of ceph is added to errors
+func (c *CephClient) monCommand(cmd map[string]interface{}) ([]byte, error) {
+	command, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Debugf("mon command: %s", command)
+	buf, info, err := c.rawMonCommand(command)
+	if err != nil {
+		if info != "" {
+			return nil, fmt.Errorf("ceph %s failed: %w, %s", cmd["prefix"], err, info)
+		}
+		return nil, fmt.Errorf("ceph %s failed: %w", cmd["prefix"], err)
+	}
+	return buf, nil
+}
+
+func (c *CephClient) CreatePool(name string, config *sdk.PoolConfig) error {
+	cmd := map[string]interface{}{
+		"prefix":    "osd pool create",
+		"pool":      name,
+		"pool_type": "replicated",
+	}
+	if config == nil || config.PgNum == 0 {
+		pgNum, err := c.defaultPgNum()
+		if err != nil {
+			return err
+		} else if pgNum > 0 {
+			cmd["pg_num"] = pgNum
+		}
+	}
+	if config != nil {
+		if config.PoolType != "" {
+			cmd["pool_type"] = config.PoolType
+		}
+		if config.ErasureCodeProfile != "" {
+			cmd["erasure_code_profile"] = config.ErasureCodeProfile
+		}
+		if config.PgNum > 0 {
+			cmd["pg_num"] = config.PgNum
+		}
+		if config.PgpNum > 0 {
+			cmd["pgp_num"] = config.PgpNum
+		}
+		if config.CrushRule != "" {
+			cmd["rule"] = config.CrushRule
+		}
+	}
+	_, err := c.monCommand(cmd)
+	return err
+}
+
+// SetPoolOption set pool variable like `ceph osd pool set {pool} {key} {value}`
+func (c *CephClient) SetPoolOption(name, key, value string) error {
+	_, err := c.monCommand(map[string]interface{}{
+		"prefix": "osd pool set",
+		"pool":   name,
+		"var":    key,
+		"val":    value,
+	})
+	return err
+}
+
+// GetPoolOptions returns the variables of `ceph osd pool get {pool} all`,
+// variables which are not set for the pool are missing
+func (c *CephClient) GetPoolOptions(name string) (map[string]string, error) {
+	buf, err := c.monCommand(map[string]interface{}{
+		"prefix": "osd pool get",
+		"pool":   name,
+		"var":    "all",
+		"format": "json",
+	})
+	if err != nil {
+		return nil, err
+	}
+	var opts map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+	if err = decoder.Decode(&opts); err != nil {
+		return nil, fmt.Errorf("parse options of pool '%s' failed: %v", name, err)
+	}
+	ret := make(map[string]string, len(opts))
+	for k, v := range opts {
+		ret[k] = fmt.Sprint(v)
+	}
+	return ret, nil
+}
+
+// SetPoolQuota set both limits like `ceph osd pool set-quota {pool} max_bytes|max_objects {value}`
+func (c *CephClient) SetPoolQuota(name string, quota *sdk.PoolQuota) error {
+	for field, val := range map[string]uint64{"max_bytes": quota.MaxBytes, "max_objects": quota.MaxObjects} {
+		_, err := c.monCommand(map[string]interface{}{
+			"prefix": "osd pool set-quota",
+			"pool":   name,
+			"field":  field,
+			"val":    fmt.Sprint(val),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPoolQuota returns the limits of `ceph osd pool get-quota {pool}`
+func (c *CephClient) GetPoolQuota(name string) (*sdk.PoolQuota, error) {
+	buf, err := c.monCommand(map[string]interface{}{
+		"prefix": "osd pool get-quota",
+		"pool":   name,
+		"format": "json",
+	})
+	if err != nil {
+		return nil, err
+	}
+	quota := &sdk.PoolQuota{}
+	if err = json.Unmarshal(buf, quota); err != nil {
+		return nil, fmt.Errorf("parse quota of pool '%s' failed: %v", name, err)
+	}
+	return quota, nil
+}
+
+// GetPoolApplications returns the applications enabled on pool, sorted
+func (c *CephClient) GetPoolApplications(name string) ([]string, error) {
+	buf, err := c.monCommand(map[string]interface{}{
+		"prefix": "osd pool application get",
+		"pool":   name,
+		"format": "json",
+	})
+	if err != nil {
+		return nil, err
+	}
+	var apps map[string]interface{}
+	if err = json.Unmarshal(buf, &apps); err != nil {
+		return nil, fmt.Errorf("parse applications of pool '%s' failed: %v", name, err)
+	}
+	ret := make([]string, 0, len(apps))
+	for app := range apps {
+		ret = append(ret, app)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// EnablePoolApplication like `ceph osd pool application enable {pool} {app}`,
+// pools may have more than one application
+func (c *CephClient) EnablePoolApplication(name, app string) error {
+	_, err := c.monCommand(map[string]interface{}{
+		"prefix":               "osd pool application enable",
+		"pool":                 name,
+		"app":                  app,
+		"yes_i_really_mean_it": true,
+	})
+	return err
+}
+
+// DisablePoolApplication like `ceph osd pool application disable {pool} {app}`
+func (c *CephClient) DisablePoolApplication(name, app string) error {
+	_, err := c.monCommand(map[string]interface{}{
+		"prefix":               "osd pool application disable",
+		"pool":                 name,
+		"app":                  app,
+		"yes_i_really_mean_it": true,
+	})
+	return err
+}
+
+// InitRBDPool initializes pool for rbd like `rbd pool init {pool}`, it
+// enables the rbd application too
+func (c *CephClient) InitRBDPool(name string) error {
+	return c.withIOContext(name, "", func(ioctx *rados.IOContext) error {
+		return rbdPoolInit(ioctx, false)
+	})
+}
+
+func (c *CephClient) DeletePool(name string) error {
+	ok, err := c.ExistPool(name)
+	if err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
+
+	if waitErr := c.wait(func() {
+		err = c.Conn.DeletePool(name)
+	}); waitErr != nil {
+		return fmt.Errorf("delete pool '%s': %w", name, waitErr)
+	}
+	if err == rados.ErrPermissionDenied {
+		return fmt.Errorf("storage pool '%s' delete failed, check if mon_allow_pool_delete is enabled: %v", name, err)
+	}
+	return err
+}
+
+func (c *CephClient) GetInfo(poolName string) (ret *sdk.StoragePoolInfo, err error) {
+	command, _ := json.Marshal(map[string]string{"prefix": "df", "format": "json"})
+	buf, _, err := c.rawMonCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("storagepool %s get info failed: %v", poolName, err)
+	}
+
+	ret = &sdk.StoragePoolInfo{}
+	var hasPool bool
+	var percentUsed float64
+	var pools []map[string]interface{}
+	utils.GetValFromJson(buf, "pools").ToVal(&pools)
+	for _, pool := range pools {
+		if pool["name"] == poolName {
+			stats := pool["stats"].(map[string]interface{})
+			if tmp, ok := stats["percent_used"]; ok {
+				percentUsed = tmp.(float64)
+				if percentUsed > 1 {
+					//ceph >= v12 版本存在percent_used字段
+					//ceph v12 percent_used字段 > 1
+					//ceph v15 percent_used字段 < 1 统一按<1处理
+					percentUsed = percentUsed / 100
+				}
+			} else {
+				percentUsed = stats["bytes_used"].(float64) / (stats["bytes_used"].(float64) + stats["max_avail"].(float64))
+			}
+			ret.Allocation = uint64(stats["bytes_used"].(float64))
+			ret.Available = uint64(stats["max_avail"].(float64))
+			ret.Capacity = uint64(stats["bytes_used"].(float64) / percentUsed)
+			hasPool = true
+			break
+		}
+	}
+	if !hasPool {
+		return nil, fmt.Errorf("storagepool %s doesn't exist", poolName)
+	}
+
+	command, _ = utils.JsonMarshal(map[string]string{"prefix": "status", "format": "json"})
+	buf, _, err = c.rawMonCommand(command)
+	if err == nil {
+		ret.StateDp = utils.GetValFromJson(buf, "health", "status").ToString()
+		if ret.StateDp == "" {
+			ret.StateDp = utils.GetValFromJson(buf, "health", "overall_status").ToString()
+		}
+		if ret.StateDp == "HEALTH_OK" {
+			ret.State = 2
+		}
+	}
+	return ret, nil
+}
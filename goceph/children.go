@@ -0,0 +1,71 @@
+package goceph
+
+import (
+	"fmt"
+	"sort"
+	"terraform-provider-ceph/ceph/sdk"
+)
+
+// childSpec is a clone of a snapshot
+type childSpec struct {
+	pool      string
+	namespace string
+	image     string
+}
+
+// ListChildren returns the ids of the clones of the snapshot, clones in the
+// trash included since nautilus
+func (s *CephSnapshot) ListChildren() ([]string, error) {
+	var ids []string
+	var err error
+	if waitErr := s.volume.wait(func() {
+		ids, err = s.listChildren()
+	}); waitErr != nil {
+		return nil, waitErr
+	}
+	return ids, err
+}
+
+func (s *CephSnapshot) listChildren() ([]string, error) {
+	specs, err := rbdListChildren(s.Ioctx, s.volume.name, s.name)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		ids = append(ids, sdk.FormatCephVol(s.volume.cluster, spec.pool, spec.namespace, spec.image))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// ListChildren returns the ids of the clones of all snapshots of the volume
+func (v *CephVolume) ListChildren() ([]string, error) {
+	var ids []string
+	var err error
+	if waitErr := v.wait(func() {
+		ids, err = v.listChildren()
+	}); waitErr != nil {
+		return nil, waitErr
+	}
+	return ids, err
+}
+
+func (v *CephVolume) listChildren() ([]string, error) {
+	snaps, err := v.Image.GetSnapshotNames()
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, snap := range snaps {
+		specs, err := rbdListChildren(v.Ioctx, v.name, snap.Name)
+		if err != nil {
+			return nil, fmt.Errorf("list children of snapshot '%s' failed: %v", snap.Name, err)
+		}
+		for _, spec := range specs {
+			ids = append(ids, sdk.FormatCephVol(v.cluster, spec.pool, spec.namespace, spec.image))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
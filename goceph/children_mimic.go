@@ -0,0 +1,31 @@
+//go:build luminous || mimic
+// +build luminous mimic
+
+// Ceph releases before Nautilus only have rbd_list_children().
+
+package goceph
+
+import (
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ceph/go-ceph/rbd"
+)
+
+// rbdListChildren returns the clones of the snapshot, clones in the trash
+// aren't listed before nautilus
+func rbdListChildren(ioctx *rados.IOContext, name, snap string) ([]childSpec, error) {
+	image, err := rbd.OpenImageReadOnly(ioctx, name, snap)
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+
+	pools, images, err := image.ListChildren()
+	if err != nil {
+		return nil, err
+	}
+	children := make([]childSpec, 0, len(images))
+	for i, image := range images {
+		children = append(children, childSpec{pool: pools[i], image: image})
+	}
+	return children, nil
+}
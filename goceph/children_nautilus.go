@@ -0,0 +1,57 @@
+//go:build !luminous && !mimic
+// +build !luminous,!mimic
+
+// Ceph Nautilus added rbd_list_children3(), which knows about namespaces and
+// the trash.
+
+package goceph
+
+/*
+#cgo LDFLAGS: -lrbd
+#include <errno.h>
+#include <stdlib.h>
+#include <rbd/librbd.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// rbdListChildren returns the clones of the snapshot, clones in the trash
+// included. rbd_list_children of go-ceph doesn't know about namespaces.
+func rbdListChildren(ioctx *rados.IOContext, name, snap string) ([]childSpec, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	cSnap := C.CString(snap)
+	defer C.free(unsafe.Pointer(cSnap))
+
+	var image C.rbd_image_t
+	if ret := C.rbd_open_read_only(C.rados_ioctx_t(ioctx.Pointer()), cName, &image, cSnap); ret < 0 {
+		return nil, getRBDError(ret)
+	}
+	defer C.rbd_close(image)
+
+	size := C.size_t(16)
+	for {
+		specs := make([]C.rbd_linked_image_spec_t, size)
+		ret := C.rbd_list_children3(image, &specs[0], &size)
+		if ret == -C.ERANGE {
+			continue
+		} else if ret < 0 {
+			return nil, getRBDError(ret)
+		}
+		children := make([]childSpec, 0, size)
+		for _, spec := range specs[:size] {
+			children = append(children, childSpec{
+				pool:      C.GoString(spec.pool_name),
+				namespace: C.GoString(spec.pool_namespace),
+				image:     C.GoString(spec.image_name),
+			})
+		}
+		C.rbd_linked_image_spec_list_cleanup(&specs[0], size)
+		return children, nil
+	}
+}
@@ -0,0 +1,94 @@
+package goceph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// capsArgs converts caps to the `caps` argument of auth commands, sorted by
+// daemon type
+func capsArgs(caps map[string]string) []string {
+	daemons := make([]string, 0, len(caps))
+	for daemon := range caps {
+		daemons = append(daemons, daemon)
+	}
+	sort.Strings(daemons)
+	args := make([]string, 0, 2*len(caps))
+	for _, daemon := range daemons {
+		args = append(args, daemon, caps[daemon])
+	}
+	return args
+}
+
+// GetClientUser returns nil if the user not exists
+func (c *CephClient) GetClientUser(name string) (*sdk.ClientUser, error) {
+	buf, err := c.monCommand(map[string]interface{}{
+		"prefix": "auth get",
+		"entity": "client." + name,
+		"format": "json",
+	})
+	if errors.Is(err, rados.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var users []authUser
+	if err = json.Unmarshal(buf, &users); err != nil {
+		return nil, fmt.Errorf("parse user 'client.%s' failed: %v", name, err)
+	} else if len(users) == 0 {
+		return nil, nil
+	}
+	user := &sdk.ClientUser{Name: name, Key: users[0].Key, Caps: users[0].Caps}
+	if user.Caps == nil {
+		user.Caps = make(map[string]string)
+	}
+	return user, nil
+}
+
+// CreateClientUser create user like `ceph auth get-or-create client.{name} ...`,
+// it fails if the user exists with other caps
+func (c *CephClient) CreateClientUser(name string, caps map[string]string) (*sdk.ClientUser, error) {
+	_, err := c.monCommand(map[string]interface{}{
+		"prefix": "auth get-or-create",
+		"entity": "client." + name,
+		"caps":   capsArgs(caps),
+		"format": "json",
+	})
+	if err != nil {
+		return nil, err
+	}
+	user, err := c.GetClientUser(name)
+	if err != nil {
+		return nil, err
+	} else if user == nil {
+		return nil, fmt.Errorf("user 'client.%s' not found after creation", name)
+	}
+	return user, nil
+}
+
+// SetClientUserCaps replaces all caps of user like `ceph auth caps`
+func (c *CephClient) SetClientUserCaps(name string, caps map[string]string) error {
+	_, err := c.monCommand(map[string]interface{}{
+		"prefix": "auth caps",
+		"entity": "client." + name,
+		"caps":   capsArgs(caps),
+	})
+	return err
+}
+
+// DeleteClientUser delete user, it's not an error if the user not exists
+func (c *CephClient) DeleteClientUser(name string) error {
+	_, err := c.monCommand(map[string]interface{}{
+		"prefix": "auth del",
+		"entity": "client." + name,
+	})
+	if errors.Is(err, rados.ErrNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package goceph
+
+import (
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/ceph/go-ceph/rbd"
+)
+
+// OpenVolSnapshot opens the snapshot of an image read-only, it returns nil
+// if the image or the snapshot doesn't exist
+func (c *CephClient) OpenVolSnapshot(pool, namespace, name, snapName string) (sdk.CephVolumeI, error) {
+	return c.waitVolume(func() (*CephVolume, error) {
+		return c.openVolSnapshot(pool, namespace, name, snapName)
+	})
+}
+
+func (c *CephClient) openVolSnapshot(pool, namespace, name, snapName string) (*CephVolume, error) {
+	ioctx, err := c.openIOContext(pool, namespace)
+	if err != nil {
+		return nil, err
+	}
+	// defer ioctx.Destroy()
+
+	vol, err := rbd.OpenImageReadOnly(ioctx, name, snapName)
+	if err == rbd.ErrNotFound {
+		ioctx.Destroy()
+		return nil, nil
+	} else if err != nil {
+		ioctx.Destroy()
+		return nil, err
+	}
+	return &CephVolume{Image: vol, Ioctx: ioctx, conn: c.Conn, cluster: c.cluster, pool: pool, namespace: namespace, name: name, ctx: c.ctx}, nil
+}
+
+// GetAllocatedExtents returns the extents of the image with data, including
+// the data of the parent, in whole objects
+func (v *CephVolume) GetAllocatedExtents() ([]sdk.Extent, error) {
+	size, err := v.Image.GetSize()
+	if err != nil {
+		return nil, err
+	}
+	var extents []sdk.Extent
+	err = v.Image.DiffIterate(rbd.DiffIterateConfig{
+		SnapName:      rbd.NoSnapshot,
+		Length:        size,
+		IncludeParent: rbd.IncludeParent,
+		WholeObject:   rbd.EnableWholeObject,
+		Callback: func(offset, length uint64, exists int, _ interface{}) int {
+			if exists != 0 {
+				extents = append(extents, sdk.Extent{Offset: offset, Length: length})
+			}
+			return 0
+		},
+	})
+	return extents, err
+}
@@ -0,0 +1,27 @@
+//go:build mimic
+// +build mimic
+
+// Ceph Mimic deep copies clones along with their parent.
+
+package goceph
+
+/*
+#cgo LDFLAGS: -lrbd
+#include <errno.h>
+#include <rbd/librbd.h>
+*/
+import "C"
+
+import "terraform-provider-ceph/ceph/sdk"
+
+// setDeepCopyFlatten refuses clones, their deep copy would stay a clone of
+// the parent before nautilus
+func setDeepCopyFlatten(src C.rbd_image_t, opts C.rbd_image_options_t) error {
+	var overlap C.uint64_t
+	if ret := C.rbd_get_overlap(src, &overlap); ret == -C.ENOENT {
+		return nil
+	} else if ret < 0 {
+		return getRBDError(ret)
+	}
+	return &sdk.UnsupportedError{Feature: "deep copy of clones with flatten", Release: "nautilus"}
+}
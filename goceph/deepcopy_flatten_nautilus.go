@@ -0,0 +1,18 @@
+//go:build !luminous && !mimic
+// +build !luminous,!mimic
+
+// Ceph Nautilus added RBD_IMAGE_OPTION_FLATTEN to deep copy clones without
+// their parent.
+
+package goceph
+
+/*
+#cgo LDFLAGS: -lrbd
+#include <rbd/librbd.h>
+*/
+import "C"
+
+// setDeepCopyFlatten makes the deep copy of src independent of its parent
+func setDeepCopyFlatten(src C.rbd_image_t, opts C.rbd_image_options_t) error {
+	return getRBDError(C.rbd_image_options_set_uint64(opts, C.RBD_IMAGE_OPTION_FLATTEN, 1))
+}
@@ -0,0 +1,16 @@
+//go:build luminous
+// +build luminous
+
+// Ceph Luminous has no rbd_deep_copy().
+
+package goceph
+
+import (
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+func rbdDeepCopy(srcIoctx *rados.IOContext, srcName, srcSnap string, dstIoctx *rados.IOContext, dstName string, config *sdk.VolumeConfig, p *sdk.Progress) error {
+	return &sdk.UnsupportedError{Feature: "deep copy of images", Release: "mimic"}
+}
@@ -0,0 +1,83 @@
+//go:build !luminous
+// +build !luminous
+
+// Ceph Mimic added rbd_deep_copy().
+
+package goceph
+
+/*
+#cgo LDFLAGS: -lrbd
+#include <stdint.h>
+#include <stdlib.h>
+#include <rbd/librbd.h>
+
+extern int progressCallback(uint64_t offset, uint64_t total, uintptr_t index);
+
+static inline int progress_cb(uint64_t offset, uint64_t total, void *index) {
+	return progressCallback(offset, total, (uintptr_t)index);
+}
+
+static inline int deep_copy_with_progress(rbd_image_t src, rados_ioctx_t dest, const char *name,
+                                          rbd_image_options_t opts, uintptr_t index) {
+	return rbd_deep_copy_with_progress(src, dest, name, opts, progress_cb, (void *)index);
+}
+*/
+import "C"
+
+import (
+	"terraform-provider-ceph/ceph/sdk"
+	"unsafe"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// rbdDeepCopy copies the image with its snapshots up to srcSnap like
+// `rbd deep cp --flatten`, zero values of config are taken from the source
+func rbdDeepCopy(srcIoctx *rados.IOContext, srcName, srcSnap string, dstIoctx *rados.IOContext, dstName string, config *sdk.VolumeConfig, p *sdk.Progress) error {
+	cSrcName := C.CString(srcName)
+	defer C.free(unsafe.Pointer(cSrcName))
+	cSrcSnap := C.CString(srcSnap)
+	defer C.free(unsafe.Pointer(cSrcSnap))
+	cDstName := C.CString(dstName)
+	defer C.free(unsafe.Pointer(cDstName))
+
+	var src C.rbd_image_t
+	if ret := C.rbd_open_read_only(C.rados_ioctx_t(srcIoctx.Pointer()), cSrcName, &src, cSrcSnap); ret < 0 {
+		return getRBDError(ret)
+	}
+	defer C.rbd_close(src)
+
+	var opts C.rbd_image_options_t
+	C.rbd_image_options_create(&opts)
+	defer C.rbd_image_options_destroy(opts)
+	if config == nil {
+		config = &sdk.VolumeConfig{}
+	}
+	for option, val := range map[C.int]uint64{
+		C.RBD_IMAGE_OPTION_ORDER:        config.Order,
+		C.RBD_IMAGE_OPTION_FEATURES:     config.Features,
+		C.RBD_IMAGE_OPTION_STRIPE_UNIT:  config.StripeUnit,
+		C.RBD_IMAGE_OPTION_STRIPE_COUNT: config.StripeCount,
+	} {
+		if val == 0 {
+			continue
+		}
+		if ret := C.rbd_image_options_set_uint64(opts, option, C.uint64_t(val)); ret < 0 {
+			return getRBDError(ret)
+		}
+	}
+	if config.DataPool != "" {
+		cDataPool := C.CString(config.DataPool)
+		defer C.free(unsafe.Pointer(cDataPool))
+		if ret := C.rbd_image_options_set_string(opts, C.RBD_IMAGE_OPTION_DATA_POOL, cDataPool); ret < 0 {
+			return getRBDError(ret)
+		}
+	}
+	if err := setDeepCopyFlatten(src, opts); err != nil {
+		return err
+	}
+
+	index := registerProgress(p)
+	defer unregisterProgress(index)
+	return getRBDError(C.deep_copy_with_progress(src, C.rados_ioctx_t(dstIoctx.Pointer()), cDstName, opts, C.uintptr_t(index)))
+}
@@ -0,0 +1,54 @@
+package goceph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// SetErasureCodeProfile create erasure code profile like
+// `ceph osd erasure-code-profile set {name} k=2 m=1 ...`
+func (c *CephClient) SetErasureCodeProfile(name string, profile map[string]string) error {
+	var pairs []string
+	for k, v := range profile {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	_, err := c.monCommand(map[string]interface{}{
+		"prefix":  "osd erasure-code-profile set",
+		"name":    name,
+		"profile": pairs,
+	})
+	return err
+}
+
+// GetErasureCodeProfile returns nil if the profile not exists
+func (c *CephClient) GetErasureCodeProfile(name string) (map[string]string, error) {
+	buf, err := c.monCommand(map[string]interface{}{
+		"prefix": "osd erasure-code-profile get",
+		"name":   name,
+		"format": "json",
+	})
+	if errors.Is(err, rados.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var profile map[string]string
+	if err = json.Unmarshal(buf, &profile); err != nil {
+		return nil, fmt.Errorf("parse erasure code profile '%s' failed: %v", name, err)
+	}
+	return profile, nil
+}
+
+// DeleteErasureCodeProfile fails while the profile is used by a pool
+func (c *CephClient) DeleteErasureCodeProfile(name string) error {
+	_, err := c.monCommand(map[string]interface{}{
+		"prefix": "osd erasure-code-profile rm",
+		"name":   name,
+	})
+	return err
+}
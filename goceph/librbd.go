@@ -0,0 +1,157 @@
+package goceph
+
+// librbd functions without bindings in go-ceph v0.3.0, the ones of this file
+// are in librbd since luminous, newer ones are in the files named after the
+// release which added them
+
+/*
+#cgo LDFLAGS: -lrbd
+#include <errno.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <rbd/librbd.h>
+
+extern int progressCallback(uint64_t offset, uint64_t total, uintptr_t index);
+
+static inline int progress_cb(uint64_t offset, uint64_t total, void *index) {
+	return progressCallback(offset, total, (uintptr_t)index);
+}
+
+static inline int flatten_with_progress(rbd_image_t image, uintptr_t index) {
+	return rbd_flatten_with_progress(image, progress_cb, (void *)index);
+}
+
+static inline int snap_rollback_with_progress(rbd_image_t image, const char *snap, uintptr_t index) {
+	return rbd_snap_rollback_with_progress(image, snap, progress_cb, (void *)index);
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"terraform-provider-ceph/ceph/sdk"
+	"unsafe"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ceph/go-ceph/rbd"
+)
+
+// getRBDError converts return codes like go-ceph, ENOENT is rbd.ErrNotFound
+func getRBDError(ret C.int) error {
+	if ret == -C.ENOENT {
+		return rbd.ErrNotFound
+	} else if ret < 0 {
+		return rbd.RBDError(ret)
+	}
+	return nil
+}
+
+// rbdPoolInit initializes the pool for rbd like `rbd pool init`
+func rbdPoolInit(ioctx *rados.IOContext, force bool) error {
+	return getRBDError(C.rbd_pool_init(C.rados_ioctx_t(ioctx.Pointer()), C.bool(force)))
+}
+
+// rbdMetadataList returns the metadata of the image, keys prefixed with conf_
+// included. go-ceph only gets and sets single keys.
+func rbdMetadataList(ioctx *rados.IOContext, name string) (map[string]string, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var image C.rbd_image_t
+	if ret := C.rbd_open_read_only(C.rados_ioctx_t(ioctx.Pointer()), cName, &image, nil); ret < 0 {
+		return nil, getRBDError(ret)
+	}
+	defer C.rbd_close(image)
+
+	cStart := C.CString("")
+	defer C.free(unsafe.Pointer(cStart))
+	keysLen, valsLen := C.size_t(1024), C.size_t(4096)
+	for {
+		keys := make([]byte, keysLen)
+		vals := make([]byte, valsLen)
+		ret := C.rbd_metadata_list(image, cStart, 0, (*C.char)(unsafe.Pointer(&keys[0])), &keysLen,
+			(*C.char)(unsafe.Pointer(&vals[0])), &valsLen)
+		if ret == -C.ERANGE {
+			continue
+		} else if ret < 0 {
+			return nil, getRBDError(ret)
+		}
+		return splitMetadata(keys[:keysLen], vals[:valsLen]), nil
+	}
+}
+
+// splitMetadata pairs the NUL terminated keys and values of a metadata list,
+// values may be empty unlike keys
+func splitMetadata(keys, vals []byte) map[string]string {
+	names := splitCStrings(keys)
+	values := bytes.Split(vals, []byte{0})
+	metadata := make(map[string]string, len(names))
+	for i, key := range names {
+		metadata[key] = string(values[i])
+	}
+	return metadata
+}
+
+// splitCStrings splits a buffer of NUL terminated strings
+func splitCStrings(buf []byte) []string {
+	var ret []string
+	for _, s := range bytes.Split(buf, []byte{0}) {
+		if len(s) > 0 {
+			ret = append(ret, string(s))
+		}
+	}
+	return ret
+}
+
+// progressCallback is called by librbd with the progress of an operation,
+// a negative return value aborts the operation
+//
+//export progressCallback
+func progressCallback(offset, total C.uint64_t, index C.uintptr_t) C.int {
+	p := lookupProgress(uintptr(index))
+	if p != nil && !p.Update(uint64(offset), uint64(total)) {
+		return -C.ECANCELED
+	}
+	return 0
+}
+
+// rbdOpen opens the image for writing, the caller has to rbd_close it
+func rbdOpen(ioctx *rados.IOContext, name string) (C.rbd_image_t, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var image C.rbd_image_t
+	if ret := C.rbd_open(C.rados_ioctx_t(ioctx.Pointer()), cName, &image, nil); ret < 0 {
+		return nil, getRBDError(ret)
+	}
+	return image, nil
+}
+
+// rbdFlatten copies the data of the parent into the image like `rbd flatten`
+func rbdFlatten(ioctx *rados.IOContext, name string, p *sdk.Progress) error {
+	image, err := rbdOpen(ioctx, name)
+	if err != nil {
+		return err
+	}
+	defer C.rbd_close(image)
+
+	index := registerProgress(p)
+	defer unregisterProgress(index)
+	return getRBDError(C.flatten_with_progress(image, C.uintptr_t(index)))
+}
+
+// rbdSnapRollback rolls the image back to the snapshot like `rbd snap rollback`
+func rbdSnapRollback(ioctx *rados.IOContext, name, snap string, p *sdk.Progress) error {
+	image, err := rbdOpen(ioctx, name)
+	if err != nil {
+		return err
+	}
+	defer C.rbd_close(image)
+
+	cSnap := C.CString(snap)
+	defer C.free(unsafe.Pointer(cSnap))
+	index := registerProgress(p)
+	defer unregisterProgress(index)
+	return getRBDError(C.snap_rollback_with_progress(image, cSnap, C.uintptr_t(index)))
+}
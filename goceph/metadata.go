@@ -0,0 +1,62 @@
+package goceph
+
+import (
+	"syscall"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ceph/go-ceph/rbd"
+)
+
+// ListMetadata returns the metadata of the image, config overrides included
+func (v *CephVolume) ListMetadata() (map[string]string, error) {
+	var metadata map[string]string
+	var err error
+	if waitErr := v.wait(func() {
+		metadata, err = rbdMetadataList(v.Ioctx, v.name)
+	}); waitErr != nil {
+		return nil, waitErr
+	}
+	return metadata, err
+}
+
+// SetMetadata sets a metadata key of the image
+func (v *CephVolume) SetMetadata(key, value string) error {
+	return v.waitCall(func() error {
+		return v.Image.SetMetadata(key, value)
+	})
+}
+
+// RemoveMetadata removes a metadata key of the image
+func (v *CephVolume) RemoveMetadata(key string) error {
+	return v.waitCall(func() error {
+		return v.Image.RemoveMetadata(key)
+	})
+}
+
+// ListPoolMetadata returns the rbd metadata of the pool, empty if the pool
+// has none or can't have any, like erasure coded pools
+func (c *CephClient) ListPoolMetadata(pool string) (map[string]string, error) {
+	var metadata map[string]string
+	err := c.withIOContext(pool, "", func(ioctx *rados.IOContext) (err error) {
+		metadata, err = rbdPoolMetadataList(ioctx)
+		return err
+	})
+	if err == rbd.ErrNotFound || err == rbd.RBDError(-int(syscall.EOPNOTSUPP)) {
+		return map[string]string{}, nil
+	}
+	return metadata, err
+}
+
+// SetPoolMetadata sets an rbd metadata key of the pool
+func (c *CephClient) SetPoolMetadata(pool, key, value string) error {
+	return c.withIOContext(pool, "", func(ioctx *rados.IOContext) error {
+		return rbdPoolMetadataSet(ioctx, key, value)
+	})
+}
+
+// RemovePoolMetadata removes an rbd metadata key of the pool
+func (c *CephClient) RemovePoolMetadata(pool, key string) error {
+	return c.withIOContext(pool, "", func(ioctx *rados.IOContext) error {
+		return rbdPoolMetadataRemove(ioctx, key)
+	})
+}
@@ -0,0 +1,116 @@
+package goceph
+
+import (
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// GetMirrorMode returns the mirror mode of the pool
+func (c *CephClient) GetMirrorMode(pool string) (string, error) {
+	var mode string
+	err := c.withIOContext(pool, "", func(ioctx *rados.IOContext) (err error) {
+		mode, err = rbdMirrorModeGet(ioctx)
+		return err
+	})
+	return mode, err
+}
+
+// SetMirrorMode sets the mirror mode of the pool, none fails while images
+// of the pool are mirrored
+func (c *CephClient) SetMirrorMode(pool, mode string) error {
+	return c.withIOContext(pool, "", func(ioctx *rados.IOContext) error {
+		return rbdMirrorModeSet(ioctx, mode)
+	})
+}
+
+// GetMirrorSiteName returns the mirror site name of the cluster, pool is
+// only used to reach it
+func (c *CephClient) GetMirrorSiteName(pool string) (string, error) {
+	var name string
+	err := c.withIOContext(pool, "", func(ioctx *rados.IOContext) (err error) {
+		name, err = rbdMirrorSiteNameGet(ioctx)
+		return err
+	})
+	return name, err
+}
+
+// CreateMirrorPeerBootstrap returns the bootstrap token of the pool, which
+// peer sites import to mirror it
+func (c *CephClient) CreateMirrorPeerBootstrap(pool string) (string, error) {
+	var token string
+	err := c.withIOContext(pool, "", func(ioctx *rados.IOContext) (err error) {
+		token, err = rbdMirrorPeerBootstrapCreate(ioctx)
+		return err
+	})
+	return token, err
+}
+
+// ImportMirrorPeerBootstrap adds the site of a bootstrap token as peer of the
+// pool, direction is rx-only or rx-tx
+func (c *CephClient) ImportMirrorPeerBootstrap(pool, direction, token string) error {
+	return c.withIOContext(pool, "", func(ioctx *rados.IOContext) error {
+		return rbdMirrorPeerBootstrapImport(ioctx, direction, token)
+	})
+}
+
+// ListMirrorPeers returns the peer sites of the pool
+func (c *CephClient) ListMirrorPeers(pool string) ([]sdk.MirrorPeer, error) {
+	var peers []sdk.MirrorPeer
+	err := c.withIOContext(pool, "", func(ioctx *rados.IOContext) (err error) {
+		peers, err = rbdMirrorPeerSiteList(ioctx)
+		return err
+	})
+	return peers, err
+}
+
+// RemoveMirrorPeer removes a peer site of the pool
+func (c *CephClient) RemoveMirrorPeer(pool, uuid string) error {
+	return c.withIOContext(pool, "", func(ioctx *rados.IOContext) error {
+		return rbdMirrorPeerSiteRemove(ioctx, uuid)
+	})
+}
+
+// GetMirrorInfo returns the mirroring state of the image
+func (v *CephVolume) GetMirrorInfo() (*sdk.MirrorImageInfo, error) {
+	var info *sdk.MirrorImageInfo
+	var err error
+	if waitErr := v.wait(func() {
+		info, err = rbdMirrorImageGetInfo(v.Ioctx, v.name)
+	}); waitErr != nil {
+		return nil, waitErr
+	}
+	return info, err
+}
+
+// EnableMirroring mirrors the image in journal or snapshot mode, journal
+// mode requires the journaling feature
+func (v *CephVolume) EnableMirroring(mode string) error {
+	return v.waitCall(func() error {
+		return rbdMirrorImageEnable(v.Ioctx, v.name, mode)
+	})
+}
+
+// DisableMirroring stops mirroring the image, force is required for
+// non-primary images
+func (v *CephVolume) DisableMirroring(force bool) error {
+	return v.waitCall(func() error {
+		return rbdMirrorImageDisable(v.Ioctx, v.name, force)
+	})
+}
+
+// PromoteMirrorImage makes the image primary, force promotes it even though
+// the peer's copy is still primary, e.g. when the peer site is down
+func (v *CephVolume) PromoteMirrorImage(force bool) error {
+	return v.waitCall(func() error {
+		return rbdMirrorImagePromote(v.Ioctx, v.name, force)
+	})
+}
+
+// DemoteMirrorImage makes the image non-primary, so that the peer's copy can
+// be promoted
+func (v *CephVolume) DemoteMirrorImage() error {
+	return v.waitCall(func() error {
+		return rbdMirrorImageDemote(v.Ioctx, v.name)
+	})
+}
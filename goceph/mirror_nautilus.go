@@ -0,0 +1,101 @@
+//go:build luminous || mimic || nautilus
+// +build luminous mimic nautilus
+
+// Ceph releases before Octopus only mirror images with journals, the mirroring
+// state of images is read but not managed.
+
+package goceph
+
+/*
+#cgo LDFLAGS: -lrbd
+#include <stdlib.h>
+#include <rbd/librbd.h>
+*/
+import "C"
+
+import (
+	"terraform-provider-ceph/ceph/sdk"
+	"unsafe"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// errMirrorUnsupported is returned by the mirroring calls needing octopus
+var errMirrorUnsupported = &sdk.UnsupportedError{Feature: "rbd mirroring", Release: "octopus"}
+
+func rbdMirrorModeGet(ioctx *rados.IOContext) (string, error) {
+	return "", errMirrorUnsupported
+}
+
+func rbdMirrorModeSet(ioctx *rados.IOContext, mode string) error {
+	return errMirrorUnsupported
+}
+
+func rbdMirrorSiteNameGet(ioctx *rados.IOContext) (string, error) {
+	return "", errMirrorUnsupported
+}
+
+func rbdMirrorPeerBootstrapCreate(ioctx *rados.IOContext) (string, error) {
+	return "", errMirrorUnsupported
+}
+
+func rbdMirrorPeerBootstrapImport(ioctx *rados.IOContext, direction, token string) error {
+	return errMirrorUnsupported
+}
+
+func rbdMirrorPeerSiteList(ioctx *rados.IOContext) ([]sdk.MirrorPeer, error) {
+	return nil, errMirrorUnsupported
+}
+
+func rbdMirrorPeerSiteRemove(ioctx *rados.IOContext, uuid string) error {
+	return errMirrorUnsupported
+}
+
+// rbdMirrorImageGetInfo returns the mirroring state of the image, which is
+// mirrored with its journal if at all
+func rbdMirrorImageGetInfo(ioctx *rados.IOContext, name string) (*sdk.MirrorImageInfo, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var image C.rbd_image_t
+	if ret := C.rbd_open_read_only(C.rados_ioctx_t(ioctx.Pointer()), cName, &image, nil); ret < 0 {
+		return nil, getRBDError(ret)
+	}
+	defer C.rbd_close(image)
+
+	var cInfo C.rbd_mirror_image_info_t
+	if ret := C.rbd_mirror_image_get_info(image, &cInfo, C.sizeof_rbd_mirror_image_info_t); ret < 0 {
+		return nil, getRBDError(ret)
+	}
+	defer C.free(unsafe.Pointer(cInfo.global_id))
+
+	info := &sdk.MirrorImageInfo{
+		State:    sdk.MirrorImageDisabled,
+		GlobalID: C.GoString(cInfo.global_id),
+		Primary:  bool(cInfo.primary),
+	}
+	switch cInfo.state {
+	case C.RBD_MIRROR_IMAGE_ENABLED:
+		info.State = sdk.MirrorImageEnabled
+		info.Mode = sdk.MirrorImageModeJournal
+	case C.RBD_MIRROR_IMAGE_DISABLING:
+		info.State = sdk.MirrorImageDisabling
+	}
+	return info, nil
+}
+
+func rbdMirrorImageEnable(ioctx *rados.IOContext, name, mode string) error {
+	return errMirrorUnsupported
+}
+
+func rbdMirrorImageDisable(ioctx *rados.IOContext, name string, force bool) error {
+	return errMirrorUnsupported
+}
+
+func rbdMirrorImagePromote(ioctx *rados.IOContext, name string, force bool) error {
+	return errMirrorUnsupported
+}
+
+func rbdMirrorImageDemote(ioctx *rados.IOContext, name string) error {
+	return errMirrorUnsupported
+}
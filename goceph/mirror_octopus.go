@@ -0,0 +1,228 @@
+//go:build !luminous && !mimic && !nautilus
+// +build !luminous,!mimic,!nautilus
+
+// Ceph Octopus added snapshot mirroring, site names and bootstrap tokens of
+// peers.
+
+package goceph
+
+/*
+#cgo LDFLAGS: -lrbd
+#include <errno.h>
+#include <stdbool.h>
+#include <stdlib.h>
+#include <rbd/librbd.h>
+*/
+import "C"
+
+import (
+	"terraform-provider-ceph/ceph/sdk"
+	"unsafe"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// rbdMirrorModeGet returns the mirror mode of the pool like `rbd mirror pool info`
+func rbdMirrorModeGet(ioctx *rados.IOContext) (string, error) {
+	var mode C.rbd_mirror_mode_t
+	if ret := C.rbd_mirror_mode_get(C.rados_ioctx_t(ioctx.Pointer()), &mode); ret < 0 {
+		return "", getRBDError(ret)
+	}
+	switch mode {
+	case C.RBD_MIRROR_MODE_IMAGE:
+		return sdk.MirrorModeImage, nil
+	case C.RBD_MIRROR_MODE_POOL:
+		return sdk.MirrorModePool, nil
+	}
+	return sdk.MirrorModeNone, nil
+}
+
+// rbdMirrorModeSet sets the mirror mode of the pool like `rbd mirror pool enable`
+func rbdMirrorModeSet(ioctx *rados.IOContext, mode string) error {
+	cMode := C.rbd_mirror_mode_t(C.RBD_MIRROR_MODE_DISABLED)
+	switch mode {
+	case sdk.MirrorModeImage:
+		cMode = C.RBD_MIRROR_MODE_IMAGE
+	case sdk.MirrorModePool:
+		cMode = C.RBD_MIRROR_MODE_POOL
+	}
+	return getRBDError(C.rbd_mirror_mode_set(C.rados_ioctx_t(ioctx.Pointer()), cMode))
+}
+
+// rbdMirrorSiteNameGet returns the mirror site name of the cluster of ioctx,
+// the fsid unless it's set
+func rbdMirrorSiteNameGet(ioctx *rados.IOContext) (string, error) {
+	cluster := C.rados_ioctx_get_cluster(C.rados_ioctx_t(ioctx.Pointer()))
+	size := C.size_t(64)
+	for {
+		buf := make([]byte, size)
+		ret := C.rbd_mirror_site_name_get(cluster, (*C.char)(unsafe.Pointer(&buf[0])), &size)
+		if ret == -C.ERANGE {
+			continue
+		} else if ret < 0 {
+			return "", getRBDError(ret)
+		}
+		return C.GoString((*C.char)(unsafe.Pointer(&buf[0]))), nil
+	}
+}
+
+// rbdMirrorPeerBootstrapCreate returns the token a peer site imports like
+// `rbd mirror pool peer bootstrap create`, it creates the cephx user of the
+// peer if needed
+func rbdMirrorPeerBootstrapCreate(ioctx *rados.IOContext) (string, error) {
+	size := C.size_t(1024)
+	for {
+		buf := make([]byte, size)
+		ret := C.rbd_mirror_peer_bootstrap_create(C.rados_ioctx_t(ioctx.Pointer()), (*C.char)(unsafe.Pointer(&buf[0])), &size)
+		if ret == -C.ERANGE {
+			continue
+		} else if ret < 0 {
+			return "", getRBDError(ret)
+		}
+		return C.GoString((*C.char)(unsafe.Pointer(&buf[0]))), nil
+	}
+}
+
+// rbdMirrorPeerBootstrapImport adds the site of the token as peer like
+// `rbd mirror pool peer bootstrap import`
+func rbdMirrorPeerBootstrapImport(ioctx *rados.IOContext, direction, token string) error {
+	cToken := C.CString(token)
+	defer C.free(unsafe.Pointer(cToken))
+
+	cDirection := C.rbd_mirror_peer_direction_t(C.RBD_MIRROR_PEER_DIRECTION_RX_TX)
+	if direction == sdk.MirrorPeerRxOnly {
+		cDirection = C.RBD_MIRROR_PEER_DIRECTION_RX
+	}
+	return getRBDError(C.rbd_mirror_peer_bootstrap_import(C.rados_ioctx_t(ioctx.Pointer()), cDirection, cToken))
+}
+
+// rbdMirrorPeerSiteList returns the peer sites of the pool
+func rbdMirrorPeerSiteList(ioctx *rados.IOContext) ([]sdk.MirrorPeer, error) {
+	size := C.int(8)
+	for {
+		sites := make([]C.rbd_mirror_peer_site_t, size)
+		ret := C.rbd_mirror_peer_site_list(C.rados_ioctx_t(ioctx.Pointer()), &sites[0], &size)
+		if ret == -C.ERANGE {
+			continue
+		} else if ret < 0 {
+			return nil, getRBDError(ret)
+		}
+		peers := make([]sdk.MirrorPeer, 0, size)
+		for _, site := range sites[:size] {
+			direction := sdk.MirrorPeerRxTx
+			switch site.direction {
+			case C.RBD_MIRROR_PEER_DIRECTION_RX:
+				direction = sdk.MirrorPeerRxOnly
+			case C.RBD_MIRROR_PEER_DIRECTION_TX:
+				direction = sdk.MirrorPeerTxOnly
+			}
+			peers = append(peers, sdk.MirrorPeer{
+				UUID:       C.GoString(site.uuid),
+				SiteName:   C.GoString(site.site_name),
+				ClientName: C.GoString(site.client_name),
+				Direction:  direction,
+			})
+		}
+		C.rbd_mirror_peer_site_list_cleanup(&sites[0], size)
+		return peers, nil
+	}
+}
+
+// rbdMirrorPeerSiteRemove removes the peer site uuid from the pool
+func rbdMirrorPeerSiteRemove(ioctx *rados.IOContext, uuid string) error {
+	cUUID := C.CString(uuid)
+	defer C.free(unsafe.Pointer(cUUID))
+
+	return getRBDError(C.rbd_mirror_peer_site_remove(C.rados_ioctx_t(ioctx.Pointer()), cUUID))
+}
+
+// rbdMirrorImageGetInfo returns the mirroring state of the image like
+// `rbd mirror image status` without the status of the peers
+func rbdMirrorImageGetInfo(ioctx *rados.IOContext, name string) (*sdk.MirrorImageInfo, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var image C.rbd_image_t
+	if ret := C.rbd_open_read_only(C.rados_ioctx_t(ioctx.Pointer()), cName, &image, nil); ret < 0 {
+		return nil, getRBDError(ret)
+	}
+	defer C.rbd_close(image)
+
+	var cInfo C.rbd_mirror_image_info_t
+	if ret := C.rbd_mirror_image_get_info(image, &cInfo, C.sizeof_rbd_mirror_image_info_t); ret < 0 {
+		return nil, getRBDError(ret)
+	}
+	defer C.rbd_mirror_image_get_info_cleanup(&cInfo)
+
+	info := &sdk.MirrorImageInfo{
+		State:    sdk.MirrorImageDisabled,
+		GlobalID: C.GoString(cInfo.global_id),
+		Primary:  bool(cInfo.primary),
+	}
+	switch cInfo.state {
+	case C.RBD_MIRROR_IMAGE_ENABLED:
+		info.State = sdk.MirrorImageEnabled
+	case C.RBD_MIRROR_IMAGE_DISABLING:
+		info.State = sdk.MirrorImageDisabling
+	}
+	if !info.Enabled() {
+		return info, nil
+	}
+	var mode C.rbd_mirror_image_mode_t
+	if ret := C.rbd_mirror_image_get_mode(image, &mode); ret < 0 {
+		return nil, getRBDError(ret)
+	}
+	info.Mode = sdk.MirrorImageModeJournal
+	if mode == C.RBD_MIRROR_IMAGE_MODE_SNAPSHOT {
+		info.Mode = sdk.MirrorImageModeSnapshot
+	}
+	return info, nil
+}
+
+// rbdMirrorImageEnable enables mirroring of the image like `rbd mirror image enable`
+func rbdMirrorImageEnable(ioctx *rados.IOContext, name, mode string) error {
+	image, err := rbdOpen(ioctx, name)
+	if err != nil {
+		return err
+	}
+	defer C.rbd_close(image)
+
+	cMode := C.rbd_mirror_image_mode_t(C.RBD_MIRROR_IMAGE_MODE_SNAPSHOT)
+	if mode == sdk.MirrorImageModeJournal {
+		cMode = C.RBD_MIRROR_IMAGE_MODE_JOURNAL
+	}
+	return getRBDError(C.rbd_mirror_image_enable2(image, cMode))
+}
+
+// rbdMirrorImageDisable disables mirroring of the image like `rbd mirror image disable`
+func rbdMirrorImageDisable(ioctx *rados.IOContext, name string, force bool) error {
+	image, err := rbdOpen(ioctx, name)
+	if err != nil {
+		return err
+	}
+	defer C.rbd_close(image)
+
+	return getRBDError(C.rbd_mirror_image_disable(image, C.bool(force)))
+}
+
+// rbdMirrorImagePromote makes the image primary like `rbd mirror image promote`
+func rbdMirrorImagePromote(ioctx *rados.IOContext, name string, force bool) error {
+	image, err := rbdOpen(ioctx, name)
+	if err != nil {
+		return err
+	}
+	defer C.rbd_close(image)
+
+	return getRBDError(C.rbd_mirror_image_promote(image, C.bool(force)))
+}
+
+// rbdMirrorImageDemote makes the image non-primary like `rbd mirror image demote`
+func rbdMirrorImageDemote(ioctx *rados.IOContext, name string) error {
+	image, err := rbdOpen(ioctx, name)
+	if err != nil {
+		return err
+	}
+	defer C.rbd_close(image)
+
+	return getRBDError(C.rbd_mirror_image_demote(image))
+}
@@ -0,0 +1,73 @@
+//go:build luminous || mimic
+// +build luminous mimic
+
+// Ceph releases before Nautilus have no rbd namespaces.
+
+package goceph
+
+import (
+	"bytes"
+	"syscall"
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ceph/go-ceph/rbd"
+)
+
+// checkNamespace refuses namespaces librbd doesn't know about, images of
+// other namespaces would be mixed up before nautilus
+func checkNamespace(namespace string) error {
+	if namespace != "" {
+		return &sdk.UnsupportedError{Feature: "rbd namespace '" + namespace + "'", Release: "nautilus"}
+	}
+	return nil
+}
+
+// rbdGetParent returns the parent of the image, nil if it isn't a clone
+func rbdGetParent(ioctx *rados.IOContext, name string) (*parentSpec, error) {
+	image, err := rbd.OpenImageReadOnly(ioctx, name, rbd.NoSnapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+
+	size := 256
+	for {
+		pool, parent, snap := make([]byte, size), make([]byte, size), make([]byte, size)
+		err := image.GetParentInfo(pool, parent, snap)
+		if err == rbd.RBDError(-int(syscall.ERANGE)) {
+			size *= 2
+			continue
+		} else if err == rbd.RBDError(-int(syscall.ENOENT)) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return &parentSpec{
+			pool:  cString(pool),
+			image: cString(parent),
+			snap:  cString(snap),
+		}, nil
+	}
+}
+
+// cString returns the NUL terminated string of buf
+func cString(buf []byte) string {
+	if i := bytes.IndexByte(buf, 0); i >= 0 {
+		buf = buf[:i]
+	}
+	return string(buf)
+}
+
+func rbdNamespaceCreate(ioctx *rados.IOContext, namespace string) error {
+	return checkNamespace(namespace)
+}
+
+func rbdNamespaceRemove(ioctx *rados.IOContext, namespace string) error {
+	return checkNamespace(namespace)
+}
+
+// rbdNamespaceList returns no namespaces, the pool has none to librbd
+func rbdNamespaceList(ioctx *rados.IOContext) ([]string, error) {
+	return nil, nil
+}
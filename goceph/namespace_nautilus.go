@@ -0,0 +1,88 @@
+//go:build !luminous && !mimic
+// +build !luminous,!mimic
+
+// Ceph Nautilus added rbd namespaces and rbd_get_parent() with them.
+
+package goceph
+
+/*
+#cgo LDFLAGS: -lrbd
+#include <errno.h>
+#include <stdlib.h>
+#include <rbd/librbd.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// checkNamespace refuses namespaces librbd doesn't know about, all are fine
+// since nautilus
+func checkNamespace(namespace string) error {
+	return nil
+}
+
+// rbdGetParent returns the parent of the image, nil if it isn't a clone.
+// rbd_get_parent_info of go-ceph doesn't know about namespaces.
+func rbdGetParent(ioctx *rados.IOContext, name string) (*parentSpec, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var image C.rbd_image_t
+	if ret := C.rbd_open_read_only(C.rados_ioctx_t(ioctx.Pointer()), cName, &image, nil); ret < 0 {
+		return nil, getRBDError(ret)
+	}
+	defer C.rbd_close(image)
+
+	var parentImage C.rbd_linked_image_spec_t
+	var parentSnap C.rbd_snap_spec_t
+	ret := C.rbd_get_parent(image, &parentImage, &parentSnap)
+	if ret == -C.ENOENT {
+		return nil, nil
+	} else if ret < 0 {
+		return nil, getRBDError(ret)
+	}
+	defer C.rbd_linked_image_spec_cleanup(&parentImage)
+	defer C.rbd_snap_spec_cleanup(&parentSnap)
+
+	return &parentSpec{
+		pool:      C.GoString(parentImage.pool_name),
+		namespace: C.GoString(parentImage.pool_namespace),
+		image:     C.GoString(parentImage.image_name),
+		snap:      C.GoString(parentSnap.name),
+	}, nil
+}
+
+// rbdNamespaceCreate creates the namespace like `rbd namespace create`
+func rbdNamespaceCreate(ioctx *rados.IOContext, namespace string) error {
+	cNamespace := C.CString(namespace)
+	defer C.free(unsafe.Pointer(cNamespace))
+
+	return getRBDError(C.rbd_namespace_create(C.rados_ioctx_t(ioctx.Pointer()), cNamespace))
+}
+
+// rbdNamespaceRemove removes the namespace, it fails while there are images in it
+func rbdNamespaceRemove(ioctx *rados.IOContext, namespace string) error {
+	cNamespace := C.CString(namespace)
+	defer C.free(unsafe.Pointer(cNamespace))
+
+	return getRBDError(C.rbd_namespace_remove(C.rados_ioctx_t(ioctx.Pointer()), cNamespace))
+}
+
+// rbdNamespaceList returns the namespaces of the pool
+func rbdNamespaceList(ioctx *rados.IOContext) ([]string, error) {
+	size := C.size_t(1024)
+	for {
+		buf := make([]byte, size)
+		ret := C.rbd_namespace_list(C.rados_ioctx_t(ioctx.Pointer()), (*C.char)(unsafe.Pointer(&buf[0])), &size)
+		if ret == -C.ERANGE {
+			continue
+		} else if ret < 0 {
+			return nil, getRBDError(ret)
+		}
+		return splitCStrings(buf[:size]), nil
+	}
+}
@@ -0,0 +1,28 @@
+//go:build luminous || mimic
+// +build luminous mimic
+
+// Ceph releases before Nautilus have no pool metadata.
+
+package goceph
+
+import (
+	"syscall"
+	"terraform-provider-ceph/ceph/sdk"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ceph/go-ceph/rbd"
+)
+
+// rbdPoolMetadataList fails like pools which can't have metadata, so that
+// ListPoolMetadata returns none
+func rbdPoolMetadataList(ioctx *rados.IOContext) (map[string]string, error) {
+	return nil, rbd.RBDError(-int(syscall.EOPNOTSUPP))
+}
+
+func rbdPoolMetadataSet(ioctx *rados.IOContext, key, value string) error {
+	return &sdk.UnsupportedError{Feature: "pool metadata", Release: "nautilus"}
+}
+
+func rbdPoolMetadataRemove(ioctx *rados.IOContext, key string) error {
+	return &sdk.UnsupportedError{Feature: "pool metadata", Release: "nautilus"}
+}
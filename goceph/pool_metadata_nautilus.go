@@ -0,0 +1,59 @@
+//go:build !luminous && !mimic
+// +build !luminous,!mimic
+
+// Ceph Nautilus added pool metadata for the config overrides of
+// `rbd config pool set`.
+
+package goceph
+
+/*
+#cgo LDFLAGS: -lrbd
+#include <errno.h>
+#include <stdlib.h>
+#include <rbd/librbd.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// rbdPoolMetadataList returns the metadata of the pool like
+// `rbd config pool list`, which shows the conf_ keys
+func rbdPoolMetadataList(ioctx *rados.IOContext) (map[string]string, error) {
+	cStart := C.CString("")
+	defer C.free(unsafe.Pointer(cStart))
+	keysLen, valsLen := C.size_t(1024), C.size_t(4096)
+	for {
+		keys := make([]byte, keysLen)
+		vals := make([]byte, valsLen)
+		ret := C.rbd_pool_metadata_list(C.rados_ioctx_t(ioctx.Pointer()), cStart, 0, (*C.char)(unsafe.Pointer(&keys[0])), &keysLen,
+			(*C.char)(unsafe.Pointer(&vals[0])), &valsLen)
+		if ret == -C.ERANGE {
+			continue
+		} else if ret < 0 {
+			return nil, getRBDError(ret)
+		}
+		return splitMetadata(keys[:keysLen], vals[:valsLen]), nil
+	}
+}
+
+// rbdPoolMetadataSet sets a metadata key of the pool
+func rbdPoolMetadataSet(ioctx *rados.IOContext, key, value string) error {
+	cKey := C.CString(key)
+	defer C.free(unsafe.Pointer(cKey))
+	cValue := C.CString(value)
+	defer C.free(unsafe.Pointer(cValue))
+
+	return getRBDError(C.rbd_pool_metadata_set(C.rados_ioctx_t(ioctx.Pointer()), cKey, cValue))
+}
+
+// rbdPoolMetadataRemove removes a metadata key of the pool
+func rbdPoolMetadataRemove(ioctx *rados.IOContext, key string) error {
+	cKey := C.CString(key)
+	defer C.free(unsafe.Pointer(cKey))
+
+	return getRBDError(C.rbd_pool_metadata_remove(C.rados_ioctx_t(ioctx.Pointer()), cKey))
+}
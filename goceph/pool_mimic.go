@@ -0,0 +1,21 @@
+//go:build luminous || mimic
+// +build luminous mimic
+
+// Ceph releases before Nautilus require pg_num to create pools.
+
+package goceph
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// defaultPgNum returns osd_pool_default_pg_num of the cluster config, which
+// `ceph osd pool create` defaults to since nautilus
+func (c *CephClient) defaultPgNum() (int, error) {
+	value, err := c.Conn.GetConfigOption("osd_pool_default_pg_num")
+	if err != nil {
+		return 0, fmt.Errorf("get osd_pool_default_pg_num failed: %w", err)
+	}
+	return strconv.Atoi(value)
+}
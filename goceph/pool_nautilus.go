@@ -0,0 +1,11 @@
+//go:build !luminous && !mimic
+// +build !luminous,!mimic
+
+// Ceph Nautilus defaults pg_num of new pools to osd_pool_default_pg_num.
+
+package goceph
+
+// defaultPgNum returns 0, the monitors pick pg_num of new pools
+func (c *CephClient) defaultPgNum() (int, error) {
+	return 0, nil
+}
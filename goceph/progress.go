@@ -0,0 +1,33 @@
+package goceph
+
+import (
+	"sync"
+	"terraform-provider-ceph/ceph/sdk"
+)
+
+var (
+	progressLock  sync.Mutex
+	progressIndex uintptr
+	progresses    = make(map[uintptr]*sdk.Progress)
+)
+
+// registerProgress returns the index passed to the progress callback of librbd
+func registerProgress(p *sdk.Progress) uintptr {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	progressIndex++
+	progresses[progressIndex] = p
+	return progressIndex
+}
+
+func unregisterProgress(index uintptr) {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	delete(progresses, index)
+}
+
+func lookupProgress(index uintptr) *sdk.Progress {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	return progresses[index]
+}
@@ -0,0 +1,51 @@
+package goceph
+
+import (
+	"terraform-provider-ceph/ceph/sdk"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ceph/go-ceph/rbd"
+)
+
+// TrashVol moves the image to the trash like `rbd trash mv`, the image can be
+// restored until it's purged, but not purged before delay is over
+func (c *CephClient) TrashVol(pool, namespace, name string, delay time.Duration) error {
+	return c.withIOContext(pool, namespace, func(ioctx *rados.IOContext) error {
+		if err := rbd.GetImage(ioctx, name).Trash(delay); err != rbd.ErrNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+// ListTrash returns the trash entries of the pool or namespace, oldest first
+func (c *CephClient) ListTrash(pool, namespace string) ([]sdk.TrashEntry, error) {
+	var infos []rbd.TrashInfo
+	err := c.withIOContext(pool, namespace, func(ioctx *rados.IOContext) (err error) {
+		infos, err = rbd.GetTrashList(ioctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]sdk.TrashEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, sdk.TrashEntry{
+			ID:            info.Id,
+			Name:          info.Name,
+			DeletionTime:  info.DeletionTime,
+			DeferredUntil: info.DefermentEndTime,
+		})
+	}
+	sdk.SortTrash(entries)
+	return entries, nil
+}
+
+// RestoreVolFromTrash restores the trash entry id as image name like
+// `rbd trash restore`
+func (c *CephClient) RestoreVolFromTrash(pool, namespace, id, name string) error {
+	return c.withIOContext(pool, namespace, func(ioctx *rados.IOContext) error {
+		return rbd.TrashRestore(ioctx, id, name)
+	})
+}
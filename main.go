@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"terraform-provider-ceph/ceph"
+	"terraform-provider-ceph/goceph"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
 	log "github.com/sirupsen/logrus"
@@ -29,6 +30,13 @@ func main() {
 		os.Exit(0)
 	}
 
+	ceph.NewCephClient = func(config *sdk.ConnConfig) (sdk.CephClientI, error) {
+		client, err := goceph.NewCephClient(config)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
 	defer ceph.CleanupCephConnections()
 
 	plugin.Serve(&plugin.ServeOpts{
@@ -39,8 +47,8 @@ func main() {
 func printVersion(cluster string, writer io.Writer) error {
 	fmt.Fprintf(writer, "%s %s\n", os.Args[0], version)
 
-	config := ceph.Config{Clusters: []string{cluster}}
-	conn, err := sdk.NewCephClient(config.Clusters[0])
+	config := ceph.Config{Clusters: []*sdk.ConnConfig{{Cluster: cluster}}}
+	conn, err := goceph.NewCephClient(config.Clusters[0])
 	if err != nil {
 		return err
 	}